@@ -0,0 +1,289 @@
+// Package bucket provides the buckets the videos are filed into, and the names of their playlists.
+package bucket
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var StrategyDay = "day"
+var StrategyWeek = "week"
+var StrategyMonth = "month"
+var StrategyQuarter = "quarter"
+var StrategyYear = "year"
+var StrategyRolling = "rolling"
+var StrategyChannel = "channel"
+
+// ignoredId is the id of the bucket of the videos left out of the playlists.
+const ignoredId = "ignored"
+
+// overflowId is the id of the bucket of the videos exceeding the watch-time budget of their period.
+const overflowId = "overflow"
+
+// Bucket represents a group of videos sharing the same playlist, like the videos of a month.
+//
+// Its id is stable whatever the name of the playlist, so that the playlist can be found again when its name changes.
+type Bucket struct {
+	// Id looks like 'day:2023-01-31', 'week:2023-W05', 'month:2023-01', 'quarter:2023-Q1' or 'year:2023', the days of
+	// a week depending on the calendar. The rolling and overflow buckets have no period, their ids are 'rolling' and
+	// 'overflow'. The bucket of a channel
+	// looks like 'channel:UCs6A_0Jm21SIvpdKyg9Gmxw'. The id of a bucket of a group is prefixed by the group name, like
+	// 'Tech/week:2023-W05'.
+	Id       string
+	Strategy string
+	// Year, Month, Week and Start describe the period of the bucket, Year being the week-year of a week.
+	Year  int
+	Month time.Month
+	Week  int
+	Start time.Time
+	// ChannelId and Channel are the id and the name of the channel whose videos are filed into the bucket, if dedicated
+	// to a channel. The name is unknown to the bucket package, so it is up to the caller to fill it.
+	ChannelId string
+	Channel   string
+	// Group is the name of the channel group of the bucket, empty for the default playlists.
+	Group string
+}
+
+// ForChannel returns the bucket dedicated to the videos of a channel.
+func ForChannel(channelId string) Bucket {
+	return Bucket{
+		Id:        StrategyChannel + ":" + channelId,
+		Strategy:  StrategyChannel,
+		ChannelId: channelId,
+	}
+}
+
+// Rolling returns the single bucket of the rolling strategy, holding the videos of the last days.
+func Rolling() Bucket {
+	return Bucket{
+		Id:       StrategyRolling,
+		Strategy: StrategyRolling,
+	}
+}
+
+// Overflow returns the single bucket of the videos which don't fit into the watch-time budget of their period.
+func Overflow() Bucket {
+	return Bucket{
+		Id:       overflowId,
+		Strategy: overflowId,
+	}
+}
+
+// Ignored returns the bucket of the videos left out of the playlists, which are recorded all the same so that they are
+// not processed again.
+func Ignored() Bucket {
+	return Bucket{
+		Id:       ignoredId,
+		Strategy: ignoredId,
+	}
+}
+
+// IsIgnored tells if the bucket holds the videos left out of the playlists.
+func (bucket Bucket) IsIgnored() bool {
+	return bucket.Strategy == ignoredId
+}
+
+// IsPeriod tells if the bucket holds the videos of a period, like a week.
+func (bucket Bucket) IsPeriod() bool {
+	switch bucket.Strategy {
+	case StrategyDay, StrategyWeek, StrategyMonth, StrategyQuarter, StrategyYear:
+		return true
+	}
+	return false
+}
+
+// InGroup returns the same bucket inside a channel group, or outside of any group if the group is empty.
+func (bucket Bucket) InGroup(group string) Bucket {
+	bucket.Id = strings.TrimPrefix(bucket.Id, bucket.Group+groupSeparator)
+	if group != "" {
+		bucket.Id = group + groupSeparator + bucket.Id
+	}
+	bucket.Group = group
+	return bucket
+}
+
+// IdPrefix returns the prefix of the ids of the buckets of a strategy inside a group, like 'Tech/week:'.
+func IdPrefix(strategy string, group string) string {
+	return Bucket{Id: strategy + ":"}.InGroup(group).Id
+}
+
+// groupSeparator separates the group name from the rest of a bucket id, so the group names can't contain it.
+const groupSeparator = "/"
+
+var (
+	dayIdRegexp     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	weekIdRegexp    = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+	monthIdRegexp   = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	quarterIdRegexp = regexp.MustCompile(`^(\d{4})-Q([1-4])$`)
+	yearIdRegexp    = regexp.MustCompile(`^\d{4}$`)
+)
+
+// Parse returns the bucket corresponding to an id, the weeks starting on the first day of the week of the calendar.
+//
+// An unknown id designates a legacy bucket, whose id is also the name of its playlist.
+func (calendar *Calendar) Parse(id string) Bucket {
+	if group, groupId, found := strings.Cut(id, groupSeparator); found && group != "" {
+		if groupBucket := calendar.parse(groupId); !groupBucket.IsLegacy() {
+			return groupBucket.InGroup(group)
+		}
+	}
+	return calendar.parse(id)
+}
+
+func (calendar *Calendar) parse(id string) Bucket {
+	if id == StrategyRolling {
+		return Rolling()
+	}
+	if id == ignoredId {
+		return Ignored()
+	}
+	if id == overflowId {
+		return Overflow()
+	}
+	strategy, period, found := strings.Cut(id, ":")
+	if found {
+		switch strategy {
+		case StrategyChannel:
+			if period != "" {
+				return ForChannel(period)
+			}
+		case StrategyDay:
+			if dayIdRegexp.MatchString(period) {
+				if day, err := time.Parse("2006-01-02", period); err == nil {
+					return dayBucket(day)
+				}
+			}
+		case StrategyQuarter:
+			if match := quarterIdRegexp.FindStringSubmatch(period); match != nil {
+				year, _ := strconv.Atoi(match[1])
+				quarter, _ := strconv.Atoi(match[2])
+				return quarterBucket(year, quarter)
+			}
+		case StrategyYear:
+			if yearIdRegexp.MatchString(period) {
+				year, _ := strconv.Atoi(period)
+				return yearBucket(year)
+			}
+		case StrategyMonth:
+			if match := monthIdRegexp.FindStringSubmatch(period); match != nil {
+				year, _ := strconv.Atoi(match[1])
+				month, _ := strconv.Atoi(match[2])
+				if month >= 1 && month <= 12 {
+					return monthBucket(year, time.Month(month))
+				}
+			}
+		case StrategyWeek:
+			if match := weekIdRegexp.FindStringSubmatch(period); match != nil {
+				year, _ := strconv.Atoi(match[1])
+				week, _ := strconv.Atoi(match[2])
+				if week >= 1 && week <= 53 {
+					return weekBucket(year, week, calendar.weekStart)
+				}
+			}
+		}
+	}
+	return Bucket{Id: id}
+}
+
+// IsLegacy tells if the bucket comes from a version which didn't identify the buckets.
+func (bucket Bucket) IsLegacy() bool {
+	return bucket.Strategy == ""
+}
+
+func dayBucket(day time.Time) Bucket {
+	return Bucket{
+		Id:       fmt.Sprintf("%s:%s", StrategyDay, day.Format("2006-01-02")),
+		Strategy: StrategyDay,
+		Year:     day.Year(),
+		Month:    day.Month(),
+		Start:    time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func quarterBucket(year int, quarter int) Bucket {
+	month := time.Month(3*(quarter-1) + 1)
+	return Bucket{
+		Id:       fmt.Sprintf("%s:%04d-Q%d", StrategyQuarter, year, quarter),
+		Strategy: StrategyQuarter,
+		Year:     year,
+		Month:    month,
+		Start:    time.Date(year, month, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func yearBucket(year int) Bucket {
+	return Bucket{
+		Id:       fmt.Sprintf("%s:%04d", StrategyYear, year),
+		Strategy: StrategyYear,
+		Year:     year,
+		Month:    time.January,
+		Start:    time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func monthBucket(year int, month time.Month) Bucket {
+	return Bucket{
+		Id:       fmt.Sprintf("%s:%04d-%02d", StrategyMonth, year, month),
+		Strategy: StrategyMonth,
+		Year:     year,
+		Month:    month,
+		Start:    time.Date(year, month, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func weekBucket(year int, week int, weekStart time.Weekday) Bucket {
+	start := firstWeekStart(year, weekStart).AddDate(0, 0, 7*(week-1))
+	return Bucket{
+		Id:       fmt.Sprintf("%s:%04d-W%02d", StrategyWeek, year, week),
+		Strategy: StrategyWeek,
+		Year:     year,
+		Month:    start.Month(),
+		Week:     week,
+		Start:    start,
+	}
+}
+
+// firstWeekStart returns the first day of the first week of a week-year.
+//
+// As for the ISO weeks, the first week is the one containing the 4th of January, that is to say the first one having
+// most of its days in the year.
+func firstWeekStart(year int, weekStart time.Weekday) time.Time {
+	fourthOfJanuary := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	return fourthOfJanuary.AddDate(0, 0, -daysSinceWeekStart(fourthOfJanuary, weekStart))
+}
+
+func daysSinceWeekStart(date time.Time, weekStart time.Weekday) int {
+	return (int(date.Weekday()) - int(weekStart) + 7) % 7
+}
+
+var (
+	legacyMonthNameRegexp = regexp.MustCompile(`^(\d{4}) (January|February|March|April|May|June|July|August|September|October|November|December)$`)
+	legacyWeekNameRegexp  = regexp.MustCompile(`^(\d{4}) Week (\d{1,2})$`)
+)
+
+// FromLegacyName returns the bucket of a playlist named by a version which didn't store the buckets, like
+// 'PF - 2023 January' or 'PF - 2023 Week 5'.
+//
+// False is returned if the name doesn't match.
+func FromLegacyName(prefix string, name string) (Bucket, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return Bucket{}, false
+	}
+	name = strings.TrimPrefix(name, prefix)
+	if match := legacyMonthNameRegexp.FindStringSubmatch(name); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		month, _ := time.Parse("January", match[2])
+		return monthBucket(year, month.Month()), true
+	}
+	if match := legacyWeekNameRegexp.FindStringSubmatch(name); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		week, _ := strconv.Atoi(match[2])
+		if week >= 1 && week <= 53 {
+			return weekBucket(year, week, time.Monday), true
+		}
+	}
+	return Bucket{}, false
+}
@@ -0,0 +1,94 @@
+package bucket
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WeekStarts lists the supported first days of the week, by name.
+var WeekStarts = map[string]time.Weekday{
+	"monday":   time.Monday,
+	"sunday":   time.Sunday,
+	"saturday": time.Saturday,
+}
+
+// DefaultCalendar uses the ISO weeks in UTC.
+var DefaultCalendar = &Calendar{location: time.UTC, weekStart: time.Monday}
+
+// Calendar determines the buckets of the dates, in a time zone and with a first day of the week.
+type Calendar struct {
+	location  *time.Location
+	weekStart time.Weekday
+}
+
+// NewCalendar returns a calendar whose weeks start on weekStart ('monday', 'sunday' or 'saturday'), in the time zone
+// named like 'Europe/Paris', 'UTC' or 'Local'.
+func NewCalendar(weekStart string, timezone string) (*Calendar, error) {
+	weekday, present := WeekStarts[strings.ToLower(weekStart)]
+	if !present {
+		return nil, fmt.Errorf("unsupported first day of the week '%s'", weekStart)
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s': %w", timezone, err)
+	}
+	return &Calendar{location: location, weekStart: weekday}, nil
+}
+
+// Location returns the time zone of the calendar.
+func (calendar *Calendar) Location() *time.Location {
+	return calendar.location
+}
+
+// ParseDay returns the start of a day formatted like '2023-01-31', in the time zone of the calendar.
+func (calendar *Calendar) ParseDay(day string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", day, calendar.location)
+}
+
+// ForDate returns the bucket of a date, according to the strategy.
+//
+// The date is first converted into the time zone of the calendar. With the week strategy, the year of the bucket is
+// the week-year: the 30th of December 2024 belongs to the first week of 2025.
+func (calendar *Calendar) ForDate(date time.Time, strategy string) Bucket {
+	date = date.In(calendar.location)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch strings.ToLower(strategy) {
+	case StrategyDay:
+		return dayBucket(day)
+	case StrategyMonth:
+		return monthBucket(day.Year(), day.Month())
+	case StrategyQuarter:
+		return quarterBucket(day.Year(), (int(day.Month())-1)/3+1)
+	case StrategyYear:
+		return yearBucket(day.Year())
+	case StrategyRolling:
+		return Rolling()
+	}
+	// the week belongs to the year of its middle day
+	middle := day.AddDate(0, 0, 3-daysSinceWeekStart(day, calendar.weekStart))
+	return weekBucket(middle.Year(), (middle.YearDay()-1)/7+1, calendar.weekStart)
+}
+
+// Next returns the bucket of the period following the one of a bucket, inside the same group. A bucket without period
+// is returned as is.
+func (calendar *Calendar) Next(bucket Bucket) Bucket {
+	var next time.Time
+	switch bucket.Strategy {
+	case StrategyDay:
+		next = bucket.Start.AddDate(0, 0, 1)
+	case StrategyWeek:
+		next = bucket.Start.AddDate(0, 0, 7)
+	case StrategyMonth:
+		next = bucket.Start.AddDate(0, 1, 0)
+	case StrategyQuarter:
+		next = bucket.Start.AddDate(0, 3, 0)
+	case StrategyYear:
+		next = bucket.Start.AddDate(1, 0, 0)
+	default:
+		return bucket
+	}
+	// the start of a period is a day, which must stay the same once converted into the time zone of the calendar
+	nextDay := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, calendar.location)
+	return calendar.ForDate(nextDay, bucket.Strategy).InGroup(bucket.Group)
+}
@@ -0,0 +1,178 @@
+package bucket
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCalendar(t *testing.T, weekStart string, timezone string) *Calendar {
+	calendar, err := NewCalendar(weekStart, timezone)
+	if err != nil {
+		t.Skipf("calendar not available: %v", err)
+	}
+	return calendar
+}
+
+func day(value string) time.Time {
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed.Add(12 * time.Hour)
+}
+
+func TestCalendarForDate(t *testing.T) {
+	tests := []struct {
+		weekStart string
+		date      time.Time
+		strategy  string
+		expected  string
+	}{
+		// ISO weeks, the week-year being the one of the thursday
+		{"monday", day("2024-12-30"), StrategyWeek, "week:2025-W01"},
+		{"monday", day("2024-12-29"), StrategyWeek, "week:2024-W52"},
+		{"monday", day("2023-01-01"), StrategyWeek, "week:2022-W52"},
+		{"monday", day("2023-01-02"), StrategyWeek, "week:2023-W01"},
+		{"monday", day("2021-01-03"), StrategyWeek, "week:2020-W53"},
+		{"monday", day("2020-12-28"), StrategyWeek, "week:2020-W53"},
+		{"monday", day("2021-01-04"), StrategyWeek, "week:2021-W01"},
+		// the weeks starting on sunday
+		{"sunday", day("2024-12-29"), StrategyWeek, "week:2025-W01"},
+		{"sunday", day("2024-12-28"), StrategyWeek, "week:2024-W52"},
+		{"sunday", day("2023-01-01"), StrategyWeek, "week:2023-W01"},
+		{"sunday", day("2022-12-31"), StrategyWeek, "week:2022-W52"},
+		// the weeks starting on saturday, 2024 having 53 of them
+		{"saturday", day("2025-01-04"), StrategyWeek, "week:2025-W01"},
+		{"saturday", day("2025-01-03"), StrategyWeek, "week:2024-W53"},
+		{"saturday", day("2023-12-30"), StrategyWeek, "week:2024-W01"},
+		// the other strategies don't depend on the first day of the week
+		{"sunday", day("2024-12-30"), StrategyDay, "day:2024-12-30"},
+		{"sunday", day("2024-12-30"), StrategyMonth, "month:2024-12"},
+		{"sunday", day("2024-12-30"), StrategyQuarter, "quarter:2024-Q4"},
+		{"sunday", day("2024-12-30"), StrategyYear, "year:2024"},
+		{"sunday", day("2024-12-30"), StrategyRolling, "rolling"},
+	}
+	for _, test := range tests {
+		calendar := newTestCalendar(t, test.weekStart, "UTC")
+		if actual := calendar.ForDate(test.date, test.strategy); actual.Id != test.expected {
+			t.Errorf("%s with the weeks starting on %s: expected '%s', got '%s'", test.date.Format("2006-01-02"), test.weekStart, test.expected, actual.Id)
+		}
+	}
+}
+
+func TestCalendarForDateInTimeZone(t *testing.T) {
+	paris := newTestCalendar(t, "monday", "Europe/Paris")
+	newYork := newTestCalendar(t, "monday", "America/New_York")
+	tests := []struct {
+		calendar *Calendar
+		date     time.Time
+		strategy string
+		expected string
+	}{
+		// 00:30 on monday in Paris
+		{paris, time.Date(2024, 12, 29, 23, 30, 0, 0, time.UTC), StrategyWeek, "week:2025-W01"},
+		{DefaultCalendar, time.Date(2024, 12, 29, 23, 30, 0, 0, time.UTC), StrategyWeek, "week:2024-W52"},
+		{paris, time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC), StrategyYear, "year:2024"},
+		// 22:00 on the 31st of January in New York
+		{newYork, time.Date(2023, 2, 1, 3, 0, 0, 0, time.UTC), StrategyMonth, "month:2023-01"},
+		{newYork, time.Date(2023, 2, 1, 3, 0, 0, 0, time.UTC), StrategyDay, "day:2023-01-31"},
+		{DefaultCalendar, time.Date(2023, 2, 1, 3, 0, 0, 0, time.UTC), StrategyMonth, "month:2023-02"},
+	}
+	for _, test := range tests {
+		if actual := test.calendar.ForDate(test.date, test.strategy); actual.Id != test.expected {
+			t.Errorf("%s in %s: expected '%s', got '%s'", test.date, test.calendar.Location(), test.expected, actual.Id)
+		}
+	}
+	start, err := paris.ParseDay("2024-12-30")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := paris.ForDate(start, StrategyWeek); actual.Id != "week:2025-W01" {
+		t.Errorf("unexpected bucket of the start of the day: '%s'", actual.Id)
+	}
+	if actual := paris.ForDate(start.Add(-time.Second), StrategyWeek); actual.Id != "week:2024-W52" {
+		t.Errorf("unexpected bucket of the end of the previous day: '%s'", actual.Id)
+	}
+}
+
+func TestCalendarNext(t *testing.T) {
+	tests := []struct {
+		weekStart string
+		timezone  string
+		id        string
+		expected  string
+	}{
+		{"monday", "UTC", "week:2020-W52", "week:2020-W53"},
+		{"monday", "UTC", "week:2020-W53", "week:2021-W01"},
+		{"monday", "UTC", "week:2024-W52", "week:2025-W01"},
+		{"sunday", "UTC", "week:2024-W52", "week:2025-W01"},
+		{"saturday", "UTC", "week:2024-W52", "week:2024-W53"},
+		{"saturday", "UTC", "week:2024-W53", "week:2025-W01"},
+		{"monday", "Europe/Paris", "week:2020-W53", "week:2021-W01"},
+		{"monday", "America/New_York", "week:2020-W53", "week:2021-W01"},
+		{"monday", "America/New_York", "day:2023-03-12", "day:2023-03-13"},
+		{"monday", "UTC", "day:2024-02-28", "day:2024-02-29"},
+		{"monday", "UTC", "month:2023-12", "month:2024-01"},
+		{"monday", "UTC", "quarter:2023-Q4", "quarter:2024-Q1"},
+		{"monday", "UTC", "year:2023", "year:2024"},
+		{"monday", "UTC", "Tech/week:2020-W53", "Tech/week:2021-W01"},
+		{"monday", "UTC", "rolling", "rolling"},
+		{"monday", "UTC", "channel:UC123", "channel:UC123"},
+	}
+	for _, test := range tests {
+		calendar := newTestCalendar(t, test.weekStart, test.timezone)
+		if actual := calendar.Next(calendar.Parse(test.id)); actual.Id != test.expected {
+			t.Errorf("'%s' with the weeks starting on %s in %s: expected '%s', got '%s'", test.id, test.weekStart, test.timezone, test.expected, actual.Id)
+		}
+	}
+}
+
+func TestCalendarParse(t *testing.T) {
+	for weekStart := range WeekStarts {
+		calendar := newTestCalendar(t, weekStart, "UTC")
+		// the buckets of the dates are found again from their id
+		for date := day("2020-12-20"); date.Before(day("2021-01-20")); date = date.AddDate(0, 0, 1) {
+			for _, strategy := range []string{StrategyDay, StrategyWeek, StrategyMonth, StrategyQuarter, StrategyYear, StrategyRolling} {
+				expected := calendar.ForDate(date, strategy).InGroup("Tech")
+				if actual := calendar.Parse(expected.Id); !reflect.DeepEqual(actual, expected) {
+					t.Errorf("'%s' with the weeks starting on %s: expected %+v, got %+v", expected.Id, weekStart, expected, actual)
+				}
+			}
+		}
+	}
+
+	calendar := DefaultCalendar
+	week := calendar.Parse("week:2025-W01")
+	if week.Year != 2025 || week.Week != 1 || !week.Start.Equal(time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected week: %+v", week)
+	}
+	for _, id := range []string{"week:2023-W54", "week:2023-W00", "month:2023-13", "day:2023-02-30", "quarter:2023-Q5", "PF - 2023 January", "/week:2023-W01"} {
+		if actual := calendar.Parse(id); !actual.IsLegacy() || actual.Id != id {
+			t.Errorf("'%s': legacy bucket expected, got %+v", id, actual)
+		}
+	}
+}
+
+func TestNewCalendar(t *testing.T) {
+	tests := []struct {
+		weekStart string
+		timezone  string
+		message   string
+	}{
+		{"Monday", "UTC", ""},
+		{"SATURDAY", "Local", ""},
+		{"tuesday", "UTC", "unsupported first day of the week 'tuesday'"},
+		{"monday", "Mars/Olympus", "unknown time zone 'Mars/Olympus'"},
+	}
+	for _, test := range tests {
+		_, err := NewCalendar(test.weekStart, test.timezone)
+		switch {
+		case test.message == "" && err != nil:
+			t.Errorf("'%s'/'%s': unexpected error: %v", test.weekStart, test.timezone, err)
+		case test.message != "" && (err == nil || !strings.Contains(err.Error(), test.message)):
+			t.Errorf("'%s'/'%s': expected an error containing \"%s\", got \"%v\"", test.weekStart, test.timezone, test.message, err)
+		}
+	}
+}
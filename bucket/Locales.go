@@ -0,0 +1,49 @@
+// Package bucket provides the buckets the videos are filed into, and the names of their playlists.
+package bucket
+
+import "time"
+
+// Locale provides the month and day names used in the playlist names.
+type Locale struct {
+	Months [12]string
+	// Days starts on Sunday, like time.Weekday.
+	Days [7]string
+}
+
+var DefaultLocale = "en"
+
+// Locales lists the supported locales, by language code.
+var Locales = map[string]Locale{
+	"en": {
+		Months: [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		Days:   [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	},
+	"fr": {
+		Months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		Days:   [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	},
+	"de": {
+		Months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		Days:   [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	},
+	"es": {
+		Months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		Days:   [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	},
+	"it": {
+		Months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		Days:   [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+	},
+}
+
+func (locale Locale) month(month time.Month) string {
+	// the rolling bucket has no month
+	if month < time.January || month > time.December {
+		return ""
+	}
+	return locale.Months[month-1]
+}
+
+func (locale Locale) day(day time.Weekday) string {
+	return locale.Days[day]
+}
@@ -0,0 +1,185 @@
+// Package bucket provides the buckets the videos are filed into, and the names of their playlists.
+package bucket
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTemplates are the templates used when none is configured, matching the names of the former versions.
+var defaultTemplates = map[string]string{
+	StrategyDay:     "{{.Prefix}}{{.Year}} {{.MonthName}} {{.Day}}",
+	StrategyWeek:    "{{.Prefix}}{{.Year}} Week {{.Week}}",
+	StrategyMonth:   "{{.Prefix}}{{.Year}} {{.MonthName}}",
+	StrategyQuarter: "{{.Prefix}}{{.Year}} Q{{.Quarter}}",
+	StrategyYear:    "{{.Prefix}}{{.Year}}",
+	StrategyRolling: "{{.Prefix}}Last {{.Days}} days",
+	StrategyChannel: "{{.Prefix}}{{.Channel}}",
+	overflowId:      "{{.Prefix}}Overflow",
+}
+
+// TemplateData represents the values available in the playlist name templates.
+type TemplateData struct {
+	Prefix string
+	// Year is the year of the bucket (the week-year of a week), ISOYear the ISO week-year of a week.
+	Year      int
+	ISOYear   int
+	Month     int
+	MonthName string
+	Week      int
+	Quarter   int
+	// Day and DayName describe the first day of the bucket.
+	Day     int
+	DayName string
+	// Days is the number of days kept by the rolling strategy.
+	Days    int
+	Channel string
+}
+
+// Namer renders the names of the playlists.
+type Namer struct {
+	prefix      string
+	templates   map[string]*template.Template
+	locale      Locale
+	rollingDays int
+}
+
+// NewNamer returns a namer using a template for all the time strategies, or the default ones if nameTemplate is empty.
+// The playlists dedicated to a channel are always named after the channel, and the overflow playlist is always named
+// 'Overflow'.
+//
+// rollingDays is the number of days kept by the rolling strategy, available in the templates.
+func NewNamer(prefix string, nameTemplate string, localeCode string, rollingDays int) (*Namer, error) {
+	locale, present := Locales[strings.ToLower(localeCode)]
+	if !present {
+		return nil, fmt.Errorf("unsupported locale '%s'", localeCode)
+	}
+	namer := &Namer{
+		prefix:      prefix,
+		templates:   make(map[string]*template.Template),
+		locale:      locale,
+		rollingDays: rollingDays,
+	}
+	for strategy, defaultTemplate := range defaultTemplates {
+		text := defaultTemplate
+		if strings.TrimSpace(nameTemplate) != "" && strategy != StrategyChannel && strategy != overflowId {
+			text = nameTemplate
+		}
+		parsed, err := template.New(strategy).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name template: %w", err)
+		}
+		namer.templates[strategy] = parsed
+		// catch the execution errors (unknown fields...) at startup
+		sample := DefaultCalendar.ForDate(time.Now(), strategy)
+		if strategy == StrategyChannel {
+			sample = ForChannel("sample")
+			sample.Channel = "Sample"
+		} else if strategy == overflowId {
+			sample = Overflow()
+		}
+		if _, err := namer.Name(sample); err != nil {
+			return nil, err
+		}
+	}
+	return namer, nil
+}
+
+// Name returns the name of the playlist of a bucket.
+func (namer *Namer) Name(bucket Bucket) (string, error) {
+	if bucket.IsLegacy() {
+		return bucket.Id, nil
+	}
+	return namer.render(bucket, namer.templateData(bucket))
+}
+
+// templateData returns the values of the fields of the name templates for a bucket.
+func (namer *Namer) templateData(bucket Bucket) TemplateData {
+	isoYear := bucket.Year
+	if bucket.Strategy == StrategyWeek {
+		isoYear, _ = bucket.Start.AddDate(0, 0, 3).ISOWeek()
+	}
+	return TemplateData{
+		Prefix:    namer.prefix,
+		Year:      bucket.Year,
+		ISOYear:   isoYear,
+		Month:     int(bucket.Month),
+		MonthName: namer.locale.month(bucket.Month),
+		Week:      bucket.Week,
+		Quarter:   (int(bucket.Month)-1)/3 + 1,
+		Day:       bucket.Start.Day(),
+		DayName:   namer.locale.day(bucket.Start.Weekday()),
+		Days:      namer.rollingDays,
+		Channel:   bucket.Channel,
+	}
+}
+
+// render returns the name of the playlist of a bucket, given the values of the fields of its template.
+func (namer *Namer) render(bucket Bucket, data TemplateData) (string, error) {
+	nameTemplate, present := namer.templates[bucket.Strategy]
+	if !present {
+		return "", fmt.Errorf("no name template for the strategy '%s'", bucket.Strategy)
+	}
+	var name strings.Builder
+	if err := nameTemplate.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", fmt.Errorf("the name template renders an empty name for the bucket '%s'", bucket.Id)
+	}
+	return name.String(), nil
+}
+
+// distinctCheckSpan is the span over which the names of the buckets of a strategy must differ, long enough to tell the
+// years apart.
+const distinctCheckSpan = 3
+
+// CheckDistinct ensures that the buckets of a strategy get different names, see Names.
+func (namer *Namer) CheckDistinct(strategy string) error {
+	_, err := namer.Names(strategy)
+	return err
+}
+
+// Names returns the ids of the buckets of a strategy by name, over a span long enough to tell the years apart. The
+// buckets named after their channel are left out.
+//
+// Error is returned if two buckets get the same name, which is the case if the name template lacks a field telling
+// them apart (like '{{.Year}}' with the week strategy), or if the rolling bucket is named from the fields of a period,
+// which are not defined for it.
+func (namer *Namer) Names(strategy string) (map[string]string, error) {
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	current := DefaultCalendar.ForDate(start, strategy)
+	bucketIds := make(map[string]string)
+	if current.Strategy == StrategyRolling {
+		name, err := namer.Name(current)
+		if err != nil {
+			return nil, err
+		}
+		// the name must not change whatever the values of the fields of the periods
+		periodData := namer.templateData(DefaultCalendar.ForDate(start, StrategyDay))
+		periodData.Channel = current.Channel
+		if periodName, err := namer.render(current, periodData); err != nil || periodName != name {
+			return nil, fmt.Errorf("the name template renders '%s' for the '%s' bucket: it can't use the fields of the periods, like '{{.Year}}'", name, strategy)
+		}
+		bucketIds[name] = current.Id
+		return bucketIds, nil
+	}
+	if !current.IsPeriod() || current.Strategy != strategy {
+		// named after its channel
+		return bucketIds, nil
+	}
+	end := start.AddDate(distinctCheckSpan, 0, 0)
+	for ; current.Start.Before(end); current = DefaultCalendar.Next(current) {
+		name, err := namer.Name(current)
+		if err != nil {
+			return nil, err
+		}
+		if otherId, present := bucketIds[name]; present {
+			return nil, fmt.Errorf("the name template renders the same name '%s' for the buckets '%s' and '%s': it must tell the '%s' buckets apart", name, otherId, current.Id, strategy)
+		}
+		bucketIds[name] = current.Id
+	}
+	return bucketIds, nil
+}
@@ -0,0 +1,79 @@
+package bucket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNamerCheckDistinct(t *testing.T) {
+	tests := []struct {
+		template string
+		strategy string
+		message  string
+	}{
+		{"", StrategyDay, ""},
+		{"", StrategyWeek, ""},
+		{"", StrategyMonth, ""},
+		{"", StrategyQuarter, ""},
+		{"", StrategyYear, ""},
+		{"{{.Prefix}}{{.Year}}", StrategyYear, ""},
+		{"{{.Prefix}}{{.Year}}", StrategyMonth, "the same name 'PF - 2023' for the buckets 'month:2023-01' and 'month:2023-02'"},
+		{"{{.Prefix}}{{.Year}}", StrategyWeek, "the same name 'PF - 2023' for the buckets 'week:2023-W01' and 'week:2023-W02'"},
+		{"{{.Prefix}}{{.Year}}", StrategyRolling, "the name template renders 'PF - 0' for the 'rolling' bucket"},
+		{"{{.Prefix}}{{.MonthName}}", StrategyRolling, "it can't use the fields of the periods"},
+		{"{{.Prefix}}{{.DayName}} {{.Days}}", StrategyRolling, "it can't use the fields of the periods"},
+		{"{{.Prefix}}Recent {{.Days}}", StrategyRolling, ""},
+		{"", StrategyRolling, ""},
+		{"{{.Prefix}}{{.Year}}", StrategyChannel, ""},
+		{"{{.Prefix}}{{.MonthName}}", StrategyMonth, "the same name 'PF - January' for the buckets 'month:2023-01' and 'month:2024-01'"},
+		{"{{.Prefix}}{{.MonthName}} {{.Year}}", StrategyMonth, ""},
+		{"{{.Prefix}}{{.MonthName}} {{.Year}}", StrategyDay, "for the buckets 'day:2023-01-01' and 'day:2023-01-02'"},
+		{"{{.Prefix}}{{.ISOYear}}-W{{.Week}}", StrategyWeek, ""},
+		{"{{.Prefix}}{{.Week}}", StrategyWeek, "it must tell the 'week' buckets apart"},
+		{"{{.Prefix}}{{.Year}} Q{{.Quarter}}", StrategyQuarter, ""},
+		{"{{.Prefix}}{{.Year}} {{.Month}}/{{.Day}}", StrategyDay, ""},
+		{"{{.Prefix}}{{.Year}} {{.DayName}}", StrategyDay, "for the buckets 'day:2023-01-01' and 'day:2023-01-08'"},
+	}
+	for _, test := range tests {
+		namer, err := NewNamer("PF - ", test.template, "en", 30)
+		if err != nil {
+			t.Fatalf("'%s': unexpected error: %v", test.template, err)
+		}
+		err = namer.CheckDistinct(test.strategy)
+		switch {
+		case test.message == "" && err != nil:
+			t.Errorf("'%s' with %s: unexpected error: %v", test.template, test.strategy, err)
+		case test.message != "" && (err == nil || !strings.Contains(err.Error(), test.message)):
+			t.Errorf("'%s' with %s: expected an error containing \"%s\", got \"%v\"", test.template, test.strategy, test.message, err)
+		}
+	}
+}
+
+func TestNamerNames(t *testing.T) {
+	namer, err := NewNamer("PF - ", "", "en", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		strategy string
+		count    int
+		name     string
+		id       string
+	}{
+		{StrategyYear, 3, "PF - 2024", "year:2024"},
+		{StrategyMonth, 36, "PF - 2025 December", "month:2025-12"},
+		{StrategyWeek, 158, "PF - 2022 Week 52", "week:2022-W52"},
+		{StrategyRolling, 1, "PF - Last 7 days", "rolling"},
+		{StrategyChannel, 0, "", ""},
+	}
+	for _, test := range tests {
+		names, err := namer.Names(test.strategy)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.strategy, err)
+			continue
+		}
+		if len(names) != test.count || (test.name != "" && names[test.name] != test.id) {
+			t.Errorf("%s: unexpected %d names, '%s' being '%s'", test.strategy, len(names), test.name, names[test.name])
+		}
+	}
+}
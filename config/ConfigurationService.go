@@ -4,7 +4,11 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/frajibe/piped-playfeed/bucket"
 	"github.com/frajibe/piped-playfeed/config/model"
+	pipedApi "github.com/frajibe/piped-playfeed/piped/api"
+	"github.com/frajibe/piped-playfeed/rules"
+	"github.com/frajibe/piped-playfeed/scheduler"
 	"github.com/frajibe/piped-playfeed/settings"
 	"github.com/frajibe/piped-playfeed/utils"
 	"github.com/go-playground/validator/v10"
@@ -74,8 +78,12 @@ func (confService *ConfigurationService) parseFile(filePath string) error {
 }
 
 func (confService *ConfigurationService) checkContent() error {
+	err := resolveCredentials(&confService.Configuration.Account)
+	if err != nil {
+		return err
+	}
 	validate := validator.New()
-	err := validate.Struct(confService.Configuration)
+	err = validate.Struct(confService.Configuration)
 	if err != nil {
 		return err
 	}
@@ -83,9 +91,28 @@ func (confService *ConfigurationService) checkContent() error {
 		// workaround for https://github.com/go-playground/validator/issues/908 since there is no "skip_unless"
 		// the synchronization struct is reduced according to the sync type
 		var synchronizationSubset = model.Synchronization{
-			Strategy:       confService.Configuration.Synchronization.Strategy,
-			PlaylistPrefix: confService.Configuration.Synchronization.PlaylistPrefix,
-			Type:           confService.Configuration.Synchronization.Type,
+			Strategy:              confService.Configuration.Synchronization.Strategy,
+			PlaylistPrefix:        confService.Configuration.Synchronization.PlaylistPrefix,
+			Type:                  confService.Configuration.Synchronization.Type,
+			OverlapHours:          confService.Configuration.Synchronization.OverlapHours,
+			NameTemplate:          confService.Configuration.Synchronization.NameTemplate,
+			Locale:                confService.Configuration.Synchronization.Locale,
+			WeekStart:             confService.Configuration.Synchronization.WeekStart,
+			Timezone:              confService.Configuration.Synchronization.Timezone,
+			RollingDays:           confService.Configuration.Synchronization.RollingDays,
+			ChannelPlaylists:      confService.Configuration.Synchronization.ChannelPlaylists,
+			ChannelOrder:          confService.Configuration.Synchronization.ChannelOrder,
+			ChannelGroups:         confService.Configuration.Synchronization.ChannelGroups,
+			Rules:                 confService.Configuration.Synchronization.Rules,
+			RulesMode:             confService.Configuration.Synchronization.RulesMode,
+			MetadataBackfill:      confService.Configuration.Synchronization.MetadataBackfill,
+			Shorts:                confService.Configuration.Synchronization.Shorts,
+			ChannelShorts:         confService.Configuration.Synchronization.ChannelShorts,
+			ShortsPlaylistPrefix:  confService.Configuration.Synchronization.ShortsPlaylistPrefix,
+			Livestreams:           confService.Configuration.Synchronization.Livestreams,
+			VideoDuration:         confService.Configuration.Synchronization.VideoDuration,
+			ChannelVideoDurations: confService.Configuration.Synchronization.ChannelVideoDurations,
+			Budget:                confService.Configuration.Synchronization.Budget,
 		}
 		if strings.EqualFold(synchronizationSubset.Type, model.SyncDurationType) {
 			synchronizationSubset.Duration = confService.Configuration.Synchronization.Duration
@@ -119,10 +146,176 @@ func (confService *ConfigurationService) checkContent() error {
 			//}
 			return err
 		}
+		err = checkNameTemplate(synchronizationSubset)
+		if err != nil {
+			return err
+		}
+		_, err = bucket.NewCalendar(synchronizationSubset.WeekStart, synchronizationSubset.Timezone)
+		if err != nil {
+			return err
+		}
+		err = checkChannelGroups(synchronizationSubset)
+		if err != nil {
+			return err
+		}
+		err = checkRules(synchronizationSubset)
+		if err != nil {
+			return err
+		}
+		err = checkDurationFilters(synchronizationSubset)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.GetSettingsService().DaemonRequested {
+		err = validate.Struct(confService.Configuration.Daemon)
+		if err != nil {
+			return err
+		}
+		_, err = scheduler.ParseSchedule(confService.Configuration.Daemon.Interval, confService.Configuration.Daemon.Cron)
+		if err != nil {
+			return utils.WrapError("invalid daemon schedule", err)
+		}
+	}
+	return nil
+}
+
+// checkNameTemplate ensures that the name template can be rendered, and that it tells apart the buckets of the
+// strategies it is used with.
+func checkNameTemplate(synchronization model.Synchronization) error {
+	namer, err := bucket.NewNamer(synchronization.PlaylistPrefix, synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+	if err != nil {
+		return err
+	}
+	if err := namer.CheckDistinct(synchronization.Strategy); err != nil {
+		return err
+	}
+	for _, channelGroup := range synchronization.ChannelGroups {
+		if err := namer.CheckDistinct(channelGroup.Strategy); err != nil {
+			return utils.WrapError(fmt.Sprintf("invalid name template for the channel group '%s'", channelGroup.Name), err)
+		}
+	}
+	return nil
+}
+
+// checkChannelGroups ensures that the groups can be told apart, that their playlists can't get the names of the
+// playlists of another group, and that a channel belongs to a single group.
+func checkChannelGroups(synchronization model.Synchronization) error {
+	groupNames := make(map[string]bool)
+	groupsByChannel := make(map[string]string)
+	for _, channelGroup := range synchronization.ChannelGroups {
+		if groupNames[channelGroup.Name] {
+			return fmt.Errorf("the channel group '%s' is declared several times", channelGroup.Name)
+		}
+		groupNames[channelGroup.Name] = true
+		if channelGroup.Name == model.ShortsGroup {
+			return fmt.Errorf("the name of the channel group '%s' is reserved to the shorts playlists", channelGroup.Name)
+		}
+		for _, channel := range channelGroup.Channels {
+			channelId := pipedApi.ExtractChannelIdFromUrl(channel)
+			if otherGroup, present := groupsByChannel[channelId]; present && otherGroup != channelGroup.Name {
+				return fmt.Errorf("the channel '%s' belongs to both groups '%s' and '%s'", channelId, otherGroup, channelGroup.Name)
+			}
+			groupsByChannel[channelId] = channelGroup.Name
+		}
+	}
+	return checkGroupPrefixes(synchronization)
+}
+
+// checkGroupPrefixes ensures that the playlist prefixes of the channel groups don't give the names of the playlists of
+// a group to the ones of another group, the default playlists or the shorts playlists.
+func checkGroupPrefixes(synchronization model.Synchronization) error {
+	type playlistFamily struct {
+		description string
+		prefix      string
+		strategy    string
+	}
+	families := []playlistFamily{{"the default playlists", synchronization.PlaylistPrefix, synchronization.Strategy}}
+	if usesShortsPlaylists(synchronization) {
+		families = append(families, playlistFamily{"the shorts playlists", synchronization.PlaylistPrefix + synchronization.ShortsPlaylistPrefix, synchronization.Strategy})
+	}
+	for _, channelGroup := range synchronization.ChannelGroups {
+		families = append(families, playlistFamily{fmt.Sprintf("the channel group '%s'", channelGroup.Name), channelGroup.PlaylistPrefix, channelGroup.Strategy})
+	}
+	familiesByName := make(map[string]string)
+	for _, family := range families {
+		namer, err := bucket.NewNamer(family.prefix, synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+		if err != nil {
+			return err
+		}
+		names, err := namer.Names(family.strategy)
+		if err != nil {
+			return err
+		}
+		for name := range names {
+			if otherFamily, present := familiesByName[name]; present && otherFamily != family.description {
+				return fmt.Errorf("%s and %s both get playlists named '%s': the playlistPrefix of the channel groups must tell them apart", otherFamily, family.description, name)
+			}
+			familiesByName[name] = family.description
+		}
 	}
 	return nil
 }
 
+// usesShortsPlaylists tells if some shorts get their own playlists.
+func usesShortsPlaylists(synchronization model.Synchronization) bool {
+	if strings.EqualFold(synchronization.Shorts, model.ShortsSeparate) {
+		return true
+	}
+	for _, shorts := range synchronization.ChannelShorts {
+		if strings.EqualFold(shorts, model.ShortsSeparate) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRules ensures that the rules can be compiled, and that their playlists can't be mistaken for the ones of the
+// channel groups.
+func checkRules(synchronization model.Synchronization) error {
+	names := make(map[string]bool)
+	for _, channelGroup := range synchronization.ChannelGroups {
+		names[channelGroup.Name] = true
+	}
+	for _, rule := range synchronization.Rules {
+		if names[rule.Name] {
+			return fmt.Errorf("the name of the rule '%s' is already used by another rule or a channel group", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Name == model.ShortsGroup {
+			return fmt.Errorf("the name of the rule '%s' is reserved to the shorts playlists", rule.Name)
+		}
+		if strings.EqualFold(rule.Action, model.RuleActionPlaylist) {
+			namer, err := bucket.NewNamer(synchronization.PlaylistPrefix, rule.Playlist, synchronization.Locale, synchronization.RollingDays)
+			if err == nil {
+				err = namer.CheckDistinct(rule.Strategy)
+			}
+			if err != nil {
+				return utils.WrapError(fmt.Sprintf("invalid playlist of the rule '%s'", rule.Name), err)
+			}
+		}
+	}
+	_, err := rules.NewEngine(synchronization.Rules, synchronization.RulesMode)
+	return err
+}
+
+// checkDurationFilters ensures that the duration filters don't leave out all the videos.
+func checkDurationFilters(synchronization model.Synchronization) error {
+	if isEmptyDurationRange(synchronization.VideoDuration) {
+		return fmt.Errorf("the maximum duration of the videos is lower than their minimum duration")
+	}
+	for channel, durationFilter := range synchronization.ChannelVideoDurations {
+		if isEmptyDurationRange(durationFilter) {
+			return fmt.Errorf("the maximum duration of the videos of the channel '%s' is lower than their minimum duration", channel)
+		}
+	}
+	return nil
+}
+
+func isEmptyDurationRange(durationFilter model.DurationFilter) bool {
+	return durationFilter.MaxDuration != 0 && durationFilter.MaxDuration < durationFilter.MinDuration
+}
+
 func pastDateValidation(fl validator.FieldLevel) bool {
 	date, err := time.Parse("2006-01-02", fl.Field().String())
 	// the date format is checked from another built-in validator, here we just check its content
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"github.com/frajibe/piped-playfeed/config/model"
+	"strings"
+	"testing"
+)
+
+func newTestSynchronization(strategy string, nameTemplate string, channelGroups ...model.ChannelGroup) model.Synchronization {
+	synchronization := model.Synchronization{
+		Strategy:      strategy,
+		NameTemplate:  nameTemplate,
+		ChannelGroups: channelGroups,
+	}
+	synchronization.SetDefaults()
+	return synchronization
+}
+
+func TestCheckNameTemplate(t *testing.T) {
+	tests := []struct {
+		name            string
+		synchronization model.Synchronization
+		message         string
+	}{
+		{"default", newTestSynchronization(model.PlaylistRollingStrategy, ""), ""},
+		{"rolling days", newTestSynchronization(model.PlaylistRollingStrategy, "{{.Prefix}}Recent {{.Days}}"), ""},
+		{"rolling year", newTestSynchronization(model.PlaylistRollingStrategy, "{{.Prefix}}{{.Year}}"),
+			"the name template renders 'PF - 0' for the 'rolling' bucket"},
+		{"rolling group", newTestSynchronization(model.PlaylistYearlyStrategy, "{{.Prefix}}{{.Year}}",
+			model.ChannelGroup{Name: "Tech", Channels: []string{"UC1"}, Strategy: model.PlaylistRollingStrategy}),
+			"invalid name template for the channel group 'Tech'"},
+		{"week year", newTestSynchronization(model.PlaylistWeeklyStrategy, "{{.Prefix}}{{.Year}}"),
+			"it must tell the 'week' buckets apart"},
+	}
+	for _, test := range tests {
+		err := checkNameTemplate(test.synchronization)
+		assertError(t, test.name, err, test.message)
+	}
+}
+
+func TestCheckChannelGroups(t *testing.T) {
+	tech := model.ChannelGroup{Name: "Tech", Channels: []string{"UC1"}}
+	news := model.ChannelGroup{Name: "News", Channels: []string{"/channel/UC2"}}
+	withPrefix := func(channelGroup model.ChannelGroup, prefix string, strategy string) model.ChannelGroup {
+		channelGroup.PlaylistPrefix = prefix
+		channelGroup.Strategy = strategy
+		return channelGroup
+	}
+	separateShorts := newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "PF - Shorts - ", ""))
+	separateShorts.Shorts = model.ShortsSeparate
+	tests := []struct {
+		name            string
+		synchronization model.Synchronization
+		message         string
+	}{
+		{"default prefixes", newTestSynchronization(model.PlaylistMonthlyStrategy, "", tech, news), ""},
+		{"same prefix", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "Feed - ", ""), withPrefix(news, "Feed - ", "")),
+			"the channel group 'Tech' and the channel group 'News' both get playlists named 'Feed - "},
+		{"same prefix, other strategies", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "Feed - ", "week"), withPrefix(news, "Feed - ", "month")), ""},
+		{"same prefix, rolling", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "Feed - ", "rolling"), withPrefix(news, "Feed - ", "rolling")),
+			"both get playlists named 'Feed - Last 7 days'"},
+		{"same prefix, channels", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "Feed - ", "channel"), withPrefix(news, "Feed - ", "channel")), ""},
+		{"default playlists prefix", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "PF - ", "")),
+			"the default playlists and the channel group 'Tech' both get playlists named 'PF - "},
+		{"unused shorts playlists", newTestSynchronization(model.PlaylistMonthlyStrategy, "", withPrefix(tech, "PF - Shorts - ", "")), ""},
+		{"shorts playlists", separateShorts, "the shorts playlists and the channel group 'Tech' both get playlists named 'PF - Shorts - "},
+		{"same group", newTestSynchronization(model.PlaylistMonthlyStrategy, "", tech, tech), "the channel group 'Tech' is declared several times"},
+		{"same channel", newTestSynchronization(model.PlaylistMonthlyStrategy, "", tech, model.ChannelGroup{Name: "News", Channels: []string{"https://www.youtube.com/channel/UC1"}}),
+			"the channel 'UC1' belongs to both groups 'Tech' and 'News'"},
+	}
+	for _, test := range tests {
+		err := checkChannelGroups(test.synchronization)
+		assertError(t, test.name, err, test.message)
+	}
+}
+
+func assertError(t *testing.T, name string, err error, message string) {
+	t.Helper()
+	switch {
+	case message == "" && err != nil:
+		t.Errorf("%s: unexpected error: %v", name, err)
+	case message != "" && (err == nil || !strings.Contains(err.Error(), message)):
+		t.Errorf("%s: expected an error containing \"%s\", got \"%v\"", name, message, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package config provides the application configuration management.
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/config/model"
+	"github.com/frajibe/piped-playfeed/utils"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds the execution of the commands providing a secret.
+var commandTimeout = 30 * time.Second
+
+// secretSources represents the sources a secret can be read from, at most one of them being defined.
+type secretSources struct {
+	name    string
+	inline  string
+	env     string
+	file    string
+	command []string
+}
+
+// resolveCredentials replaces the password and the token by the content of their alternative sources, if any.
+func resolveCredentials(account *model.Account) error {
+	password, err := resolveSecret(secretSources{
+		name:    "password",
+		inline:  account.Password,
+		env:     account.PasswordEnv,
+		file:    account.PasswordFile,
+		command: account.PasswordCommand,
+	})
+	if err != nil {
+		return err
+	}
+	account.Password = password
+
+	token, err := resolveSecret(secretSources{
+		name:    "token",
+		inline:  account.Token,
+		env:     account.TokenEnv,
+		file:    account.TokenFile,
+		command: account.TokenCommand,
+	})
+	if err != nil {
+		return err
+	}
+	account.Token = token
+	return nil
+}
+
+func resolveSecret(sources secretSources) (string, error) {
+	var defined []string
+	if sources.inline != "" {
+		defined = append(defined, sources.name)
+	}
+	if sources.env != "" {
+		defined = append(defined, sources.name+"Env")
+	}
+	if sources.file != "" {
+		defined = append(defined, sources.name+"File")
+	}
+	if len(sources.command) != 0 {
+		defined = append(defined, sources.name+"Command")
+	}
+	if len(defined) > 1 {
+		return "", fmt.Errorf("account: only one source is allowed for the %s, found '%s'", sources.name, strings.Join(defined, "', '"))
+	}
+
+	switch {
+	case sources.env != "":
+		value, present := os.LookupEnv(sources.env)
+		if !present || value == "" {
+			return "", fmt.Errorf("account.%sEnv: the environment variable '%s' is not defined", sources.name, sources.env)
+		}
+		return value, nil
+	case sources.file != "":
+		value, err := readSecretFile(sources.file)
+		if err != nil {
+			return "", utils.WrapError(fmt.Sprintf("account.%sFile: unable to read '%s'", sources.name, sources.file), err)
+		}
+		return value, nil
+	case len(sources.command) != 0:
+		value, err := runSecretCommand(sources.command)
+		if err != nil {
+			return "", utils.WrapError(fmt.Sprintf("account.%sCommand: '%s' failed", sources.name, strings.Join(sources.command, " ")), err)
+		}
+		return value, nil
+	default:
+		return sources.inline, nil
+	}
+}
+
+// readSecretFile returns the first line of a file which must only be accessible to its owner.
+func readSecretFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	// the permissions are not meaningful on Windows
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("permissions %#o are too open, the file must not be accessible by the group or the others (chmod 600)", info.Mode().Perm())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(strings.SplitN(string(content), "\n", 2)[0], "\r")
+	if value == "" {
+		return "", errors.New("the file is empty")
+	}
+	return value, nil
+}
+
+// runSecretCommand returns the first line printed by a command, like 'pass show piped'.
+func runSecretCommand(command []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("no answer after %s", commandTimeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", utils.WrapError(message, err)
+		}
+		return "", err
+	}
+	value := strings.TrimRight(strings.SplitN(stdout.String(), "\n", 2)[0], "\r")
+	if value == "" {
+		return "", errors.New("nothing printed on the standard output")
+	}
+	return value, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"github.com/frajibe/piped-playfeed/config/model"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveSecretFromEnv(t *testing.T) {
+	t.Setenv("PF_TEST_PASSWORD", "secret")
+	t.Setenv("PF_TEST_EMPTY", "")
+	tests := []struct {
+		env      string
+		expected string
+		message  string
+	}{
+		{"PF_TEST_PASSWORD", "secret", ""},
+		{"PF_TEST_MISSING", "", "account.passwordEnv: the environment variable 'PF_TEST_MISSING' is not defined"},
+		{"PF_TEST_EMPTY", "", "account.passwordEnv: the environment variable 'PF_TEST_EMPTY' is not defined"},
+	}
+	for _, test := range tests {
+		value, err := resolveSecret(secretSources{name: "password", env: test.env})
+		assertSecret(t, test.env, value, err, test.expected, test.message)
+	}
+}
+
+func TestResolveSecretFromFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, content string, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatalf("unable to write '%s': %v", path, err)
+		}
+		// the umask may have restricted the permissions
+		if err := os.Chmod(path, perm); err != nil {
+			t.Fatalf("unable to chmod '%s': %v", path, err)
+		}
+		return path
+	}
+	tests := []struct {
+		path     string
+		expected string
+		message  string
+	}{
+		{writeFile("plain", "secret", 0o600), "secret", ""},
+		{writeFile("newline", "secret\n", 0o600), "secret", ""},
+		{writeFile("crlf", "secret\r\n", 0o400), "secret", ""},
+		{writeFile("lines", "secret\nsomething else\n", 0o600), "secret", ""},
+		{writeFile("empty", "\nsecret\n", 0o600), "", "the file is empty"},
+		{filepath.Join(dir, "missing"), "", "account.passwordFile: unable to read"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, []struct {
+			path     string
+			expected string
+			message  string
+		}{
+			{writeFile("group", "secret\n", 0o640), "", "permissions 0640 are too open"},
+			{writeFile("others", "secret\n", 0o604), "", "permissions 0604 are too open"},
+			{writeFile("all", "secret\n", 0o666), "", "permissions 0666 are too open"},
+		}...)
+	}
+	for _, test := range tests {
+		value, err := resolveSecret(secretSources{name: "password", file: test.path})
+		assertSecret(t, filepath.Base(test.path), value, err, test.expected, test.message)
+	}
+}
+
+func TestResolveSecretFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands rely on a POSIX shell")
+	}
+	tests := []struct {
+		command  []string
+		expected string
+		message  string
+	}{
+		{[]string{"echo", "secret"}, "secret", ""},
+		{[]string{"sh", "-c", "printf 'secret\\r\\nsomething else\\n'"}, "secret", ""},
+		{[]string{"sh", "-c", "echo 'no such entry' >&2; exit 3"}, "", "no such entry"},
+		{[]string{"sh", "-c", "exit 1"}, "", "exit status 1"},
+		{[]string{"true"}, "", "nothing printed on the standard output"},
+		{[]string{"pf-test-missing-command"}, "", "account.passwordCommand: 'pf-test-missing-command' failed"},
+	}
+	for _, test := range tests {
+		value, err := resolveSecret(secretSources{name: "password", command: test.command})
+		assertSecret(t, strings.Join(test.command, " "), value, err, test.expected, test.message)
+	}
+}
+
+func TestResolveSecretCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands rely on a POSIX shell")
+	}
+	defaultTimeout := commandTimeout
+	commandTimeout = 100 * time.Millisecond
+	defer func() { commandTimeout = defaultTimeout }()
+
+	start := time.Now()
+	value, err := resolveSecret(secretSources{name: "token", command: []string{"sleep", "10"}})
+	assertSecret(t, "sleep", value, err, "", "account.tokenCommand: 'sleep 10' failed > no answer after 100ms")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command has not been stopped, %s elapsed", elapsed)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv("PF_TEST_PASSWORD", "secret")
+	account := model.Account{Username: "user", PasswordEnv: "PF_TEST_PASSWORD"}
+	if err := resolveCredentials(&account); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if account.Password != "secret" || account.Token != "" {
+		t.Errorf("unexpected account: %+v", account)
+	}
+
+	account = model.Account{Username: "user", Password: "inline", PasswordEnv: "PF_TEST_PASSWORD", PasswordCommand: []string{"echo"}}
+	err := resolveCredentials(&account)
+	if err == nil || err.Error() != "account: only one source is allowed for the password, found 'password', 'passwordEnv', 'passwordCommand'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func assertSecret(t *testing.T, name string, value string, err error, expected string, message string) {
+	t.Helper()
+	switch {
+	case message == "" && err != nil:
+		t.Errorf("%s: unexpected error: %v", name, err)
+	case message != "" && (err == nil || !strings.Contains(err.Error(), message)):
+		t.Errorf("%s: expected an error containing \"%s\", got \"%v\"", name, message, err)
+	case value != expected:
+		t.Errorf("%s: expected '%s', got '%s'", name, expected, value)
+	}
+}
@@ -1,6 +1,16 @@
 package model
 
 type Account struct {
-	Username string `validate:"required"`
-	Password string `validate:"required"`
+	Username string `validate:"required_without=Token"`
+	Password string `validate:"required_without=Token"`
+	// PasswordEnv, PasswordFile and PasswordCommand are the alternative sources of the password.
+	PasswordEnv     string
+	PasswordFile    string
+	PasswordCommand []string
+	// Token is a pre-issued authentication token, used instead of the username and password.
+	Token string
+	// TokenEnv, TokenFile and TokenCommand are the alternative sources of the token.
+	TokenEnv     string
+	TokenFile    string
+	TokenCommand []string
 }
@@ -0,0 +1,23 @@
+package model
+
+import "strings"
+
+var BudgetOverflowNext = "next"
+var BudgetOverflowPlaylist = "playlist"
+
+// Budget represents the watch-time budget of the period playlists (day, week, month, quarter and year), the videos
+// exceeding it going to the playlist of the next period or to an overflow playlist.
+type Budget struct {
+	// Hours is the maximum duration of the videos of a period playlist, 0 disabling the budget.
+	Hours    int    `validate:"min=0"`
+	Overflow string `validate:"oneof=next playlist"`
+	// ChannelPriorities lists the channels filling the playlists first, by id or by subscription url, the other channels
+	// coming last.
+	ChannelPriorities []string `validate:"dive,required"`
+}
+
+func (budget *Budget) SetDefaults() {
+	if strings.TrimSpace(budget.Overflow) == "" {
+		budget.Overflow = BudgetOverflowNext
+	}
+}
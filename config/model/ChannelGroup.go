@@ -0,0 +1,27 @@
+package model
+
+import "strings"
+
+// ChannelGroup represents a group of channels whose videos are filed into their own family of playlists.
+type ChannelGroup struct {
+	// Name identifies the group in the database, so it must not change.
+	Name string `validate:"required,excludesall=/"`
+	// Channels lists the channels of the group, by id or by subscription url.
+	Channels       []string `validate:"required,dive,required"`
+	PlaylistPrefix string
+	Strategy       string `validate:"oneof=day week month quarter year rolling channel"`
+}
+
+// DefaultGroupPlaylistPrefix returns the prefix of the playlists of a group when none is configured, like 'Tech - '.
+func DefaultGroupPlaylistPrefix(name string) string {
+	return name + " - "
+}
+
+func (channelGroup *ChannelGroup) SetDefaults(strategy string) {
+	if strings.TrimSpace(channelGroup.PlaylistPrefix) == "" {
+		channelGroup.PlaylistPrefix = DefaultGroupPlaylistPrefix(channelGroup.Name)
+	}
+	if strings.TrimSpace(channelGroup.Strategy) == "" {
+		channelGroup.Strategy = strategy
+	}
+}
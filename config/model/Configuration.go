@@ -5,15 +5,20 @@ import "strings"
 var defaultDatabaseName = "piped-playfeed.db"
 
 type Configuration struct {
-	Instance        string  `validate:"required"`
-	Account         Account `validate:"required"`
-	Database        string
-	Synchronization Synchronization `validate:"-"`
+	Instance          string   `validate:"required"`
+	FallbackInstances []string `validate:"dive,required"`
+	SpreadReads       bool
+	Account           Account `validate:"required"`
+	Database          string
+	Network           Network
+	Synchronization   Synchronization `validate:"-"`
+	Daemon            Daemon          `validate:"-"`
 }
 
 func (configuration *Configuration) SetDefaults() {
 	if strings.TrimSpace(configuration.Database) == "" {
 		configuration.Database = defaultDatabaseName
 	}
+	configuration.Network.SetDefaults()
 	configuration.Synchronization.SetDefaults()
 }
@@ -0,0 +1,13 @@
+package model
+
+// Daemon represents the schedule of the synchronizations in daemon mode, defined either by an interval or by a cron
+// expression.
+type Daemon struct {
+	// Interval is a duration like '6h' or '90m'.
+	Interval string
+	// Cron is a standard cron expression like '0 */6 * * *', evaluated in the local time zone.
+	Cron          string
+	JitterSeconds int `validate:"min=0,max=3600"`
+	// RunAtStartup launches a synchronization as soon as the daemon starts, without waiting for the first tick.
+	RunAtStartup bool
+}
@@ -0,0 +1,9 @@
+package model
+
+// DurationFilter represents the range of durations of the videos filed into the playlists, the other videos being left
+// out.
+type DurationFilter struct {
+	// MinDuration and MaxDuration bound the duration of the videos in seconds, 0 for no bound.
+	MinDuration int64 `validate:"min=0"`
+	MaxDuration int64 `validate:"min=0"`
+}
@@ -0,0 +1,46 @@
+package model
+
+var defaultConcurrency = 8
+var defaultMaxAttempts = 4
+var defaultInitialDelayMs = 1000
+var defaultMaxDelayMs = 30000
+var defaultFailureThreshold = 5
+var defaultPauseSeconds = 60
+
+type Network struct {
+	Concurrency    int `validate:"min=1,max=64"`
+	Retry          Retry
+	CircuitBreaker CircuitBreaker
+}
+
+type Retry struct {
+	MaxAttempts    int `validate:"min=1,max=20"`
+	InitialDelayMs int `validate:"min=1"`
+	MaxDelayMs     int `validate:"gtefield=InitialDelayMs"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int `validate:"min=1"`
+	PauseSeconds     int `validate:"min=1,max=3600"`
+}
+
+func (network *Network) SetDefaults() {
+	if network.Concurrency == 0 {
+		network.Concurrency = defaultConcurrency
+	}
+	if network.Retry.MaxAttempts == 0 {
+		network.Retry.MaxAttempts = defaultMaxAttempts
+	}
+	if network.Retry.InitialDelayMs == 0 {
+		network.Retry.InitialDelayMs = defaultInitialDelayMs
+	}
+	if network.Retry.MaxDelayMs == 0 {
+		network.Retry.MaxDelayMs = defaultMaxDelayMs
+	}
+	if network.CircuitBreaker.FailureThreshold == 0 {
+		network.CircuitBreaker.FailureThreshold = defaultFailureThreshold
+	}
+	if network.CircuitBreaker.PauseSeconds == 0 {
+		network.CircuitBreaker.PauseSeconds = defaultPauseSeconds
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+import "strings"
+
+var RuleActionPlaylist = "playlist"
+var RuleActionIgnore = "ignore"
+
+var RulesModeFirst = "first"
+var RulesModeAll = "all"
+
+// Rule represents a routing rule, sending the videos matching all its conditions to its playlists or ignoring them.
+//
+// The conditions left empty match all the videos.
+type Rule struct {
+	// Name identifies the playlists of the rule in the database, so it must not change.
+	Name string `validate:"required,excludesall=/"`
+	// Channels lists the channels matched by the rule, by id or by subscription url.
+	Channels []string `validate:"dive,required"`
+	// Title is a regular expression matching the title of the videos.
+	Title string
+	// MinDuration and MaxDuration bound the duration of the videos in seconds, 0 for no bound.
+	MinDuration int64 `validate:"min=0"`
+	MaxDuration int64 `validate:"min=0"`
+	// Categories lists the categories of the videos, like 'Music' or 'Gaming'.
+	Categories []string `validate:"dive,required"`
+	// Weekdays lists the upload days of the videos, like 'monday'.
+	Weekdays []string `validate:"dive,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	Action   string   `validate:"oneof=playlist ignore"`
+	// Playlist is the template of the names of the playlists of the rule, like the NameTemplate of the synchronization.
+	Playlist string `validate:"required_if=Action playlist"`
+	Strategy string `validate:"oneof=day week month quarter year rolling channel"`
+}
+
+func (rule *Rule) SetDefaults(strategy string) {
+	if strings.TrimSpace(rule.Action) == "" {
+		rule.Action = RuleActionPlaylist
+	}
+	if strings.TrimSpace(rule.Strategy) == "" {
+		rule.Strategy = strategy
+	}
+}
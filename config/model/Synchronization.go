@@ -6,18 +6,85 @@ import (
 )
 
 var defaultPlaylistPrefix = "PF - "
+var defaultOverlapHours = 24
+var defaultLocale = "en"
+var defaultWeekStart = "monday"
+var defaultTimezone = "Local"
+var defaultRollingDays = 7
+var defaultChannelOrder = "newest"
+var defaultRulesMode = "first"
+var defaultMetadataBackfill = 50
+var defaultShortsPlaylistPrefix = "Shorts - "
 var SyncDurationType = "duration"
 var SyncDateType = "date"
 
+var PlaylistDailyStrategy = "day"
 var PlaylistWeeklyStrategy = "week"
 var PlaylistMonthlyStrategy = "month"
+var PlaylistQuarterlyStrategy = "quarter"
+var PlaylistYearlyStrategy = "year"
+var PlaylistRollingStrategy = "rolling"
+var PlaylistChannelStrategy = "channel"
+
+var ChannelOrderNewest = "newest"
+var ChannelOrderOldest = "oldest"
+
+var ShortsInclude = "include"
+var ShortsExclude = "exclude"
+var ShortsSeparate = "separate"
+
+var LivestreamsInclude = "include"
+var LivestreamsExclude = "exclude"
+
+// ShortsGroup is the group of the playlists dedicated to the shorts, which can't be used by a channel group nor a rule.
+var ShortsGroup = "shorts"
 
 type Synchronization struct {
-	Strategy       string `validate:"oneof=week month"`
+	Strategy       string `validate:"oneof=day week month quarter year rolling channel"`
 	PlaylistPrefix string
 	Type           string   `validate:"oneof=date duration"`
 	Date           string   `validate:"datetime=2006-01-02,dateinpast"`
 	Duration       Duration `validate:"required"`
+	// OverlapHours is the window before the last video seen of a channel which is browsed again, so that the videos
+	// listed late by the instance are not missed.
+	OverlapHours int `validate:"min=1,max=720"`
+	// NameTemplate is the text/template rendering the playlist names, the names of the former versions if empty.
+	NameTemplate string
+	// Locale is the language of the month and day names available in the name template.
+	Locale string `validate:"oneof=en fr de es it"`
+	// WeekStart is the first day of the weeks of the week strategy.
+	WeekStart string `validate:"oneof=monday sunday saturday"`
+	// Timezone is the time zone of the dates, like 'Europe/Paris', 'UTC' or 'Local'.
+	Timezone string
+	// RollingDays is the number of days kept by the rolling strategy.
+	RollingDays int `validate:"min=1,max=365"`
+	// ChannelPlaylists lists the ids of the channels having their own playlist, whatever the strategy.
+	ChannelPlaylists []string `validate:"dive,required"`
+	// ChannelOrder is the order of the videos inside the playlists dedicated to a channel.
+	ChannelOrder string `validate:"oneof=newest oldest"`
+	// ChannelGroups lists the groups of channels having their own playlists, the other channels using the ones above.
+	ChannelGroups []ChannelGroup `validate:"dive"`
+	// Rules lists the routing rules, evaluated in order before the channel groups.
+	Rules []Rule `validate:"dive"`
+	// RulesMode tells if a video goes to the playlists of the first matching rule only, or of all the matching ones.
+	RulesMode string `validate:"oneof=first all"`
+	// MetadataBackfill is the number of videos whose metadata are completed from their details at each synchronization.
+	MetadataBackfill int `validate:"min=1,max=1000"`
+	// Shorts tells if the shorts are filed like the other videos, left out, or filed into their own playlists.
+	Shorts string `validate:"oneof=include exclude separate"`
+	// ChannelShorts overrides the shorts policy for some channels, by id or by subscription url.
+	ChannelShorts map[string]string `validate:"dive,keys,required,endkeys,oneof=include exclude separate"`
+	// ShortsPlaylistPrefix is the prefix of the playlists dedicated to the shorts, appended to PlaylistPrefix.
+	ShortsPlaylistPrefix string
+	// Livestreams tells if the VODs of the livestreams are filed like the other videos, or left out. Only the
+	// livestreams seen scheduled or on air by a synchronization are known as such.
+	Livestreams string `validate:"oneof=include exclude"`
+	// VideoDuration leaves out the videos too short or too long, ChannelVideoDurations overriding it for some channels,
+	// by id or by subscription url.
+	VideoDuration         DurationFilter
+	ChannelVideoDurations map[string]DurationFilter `validate:"dive,keys,required,endkeys"`
+	// Budget limits the duration of the videos of the period playlists.
+	Budget Budget
 }
 
 func (synchronization *Synchronization) SetDefaults() {
@@ -33,5 +100,45 @@ func (synchronization *Synchronization) SetDefaults() {
 	if strings.TrimSpace(synchronization.Date) == "" {
 		synchronization.Date = time.Now().Local().AddDate(0, -1, 0).Format("2006-01-02")
 	}
+	if synchronization.OverlapHours == 0 {
+		synchronization.OverlapHours = defaultOverlapHours
+	}
+	if strings.TrimSpace(synchronization.Locale) == "" {
+		synchronization.Locale = defaultLocale
+	}
+	if strings.TrimSpace(synchronization.WeekStart) == "" {
+		synchronization.WeekStart = defaultWeekStart
+	}
+	if strings.TrimSpace(synchronization.Timezone) == "" {
+		synchronization.Timezone = defaultTimezone
+	}
+	if synchronization.RollingDays == 0 {
+		synchronization.RollingDays = defaultRollingDays
+	}
+	if strings.TrimSpace(synchronization.ChannelOrder) == "" {
+		synchronization.ChannelOrder = defaultChannelOrder
+	}
+	if strings.TrimSpace(synchronization.RulesMode) == "" {
+		synchronization.RulesMode = defaultRulesMode
+	}
+	if synchronization.MetadataBackfill == 0 {
+		synchronization.MetadataBackfill = defaultMetadataBackfill
+	}
+	if strings.TrimSpace(synchronization.Shorts) == "" {
+		synchronization.Shorts = ShortsInclude
+	}
+	if strings.TrimSpace(synchronization.ShortsPlaylistPrefix) == "" {
+		synchronization.ShortsPlaylistPrefix = defaultShortsPlaylistPrefix
+	}
+	if strings.TrimSpace(synchronization.Livestreams) == "" {
+		synchronization.Livestreams = LivestreamsInclude
+	}
 	synchronization.Duration.SetDefaults()
+	synchronization.Budget.SetDefaults()
+	for i := range synchronization.ChannelGroups {
+		synchronization.ChannelGroups[i].SetDefaults(synchronization.Strategy)
+	}
+	for i := range synchronization.Rules {
+		synchronization.Rules[i].SetDefaults(synchronization.Strategy)
+	}
 }
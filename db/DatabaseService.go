@@ -5,9 +5,17 @@ import (
 	"fmt"
 	"github.com/frajibe/piped-playfeed/config"
 	channelDb "github.com/frajibe/piped-playfeed/db/channel"
+	metadataDb "github.com/frajibe/piped-playfeed/db/metadata"
+	"github.com/frajibe/piped-playfeed/db/migration"
+	playlistDb "github.com/frajibe/piped-playfeed/db/playlist"
+	runDb "github.com/frajibe/piped-playfeed/db/run"
+	tokenDb "github.com/frajibe/piped-playfeed/db/token"
+	upcomingDb "github.com/frajibe/piped-playfeed/db/upcoming"
 	videoDb "github.com/frajibe/piped-playfeed/db/video"
+	"github.com/frajibe/piped-playfeed/settings"
 	"github.com/frajibe/piped-playfeed/utils"
 	_ "github.com/mattn/go-sqlite3"
+	"os"
 	"sync"
 )
 
@@ -15,8 +23,16 @@ var instance *DatabaseService
 var mutex sync.Mutex
 
 type DatabaseService struct {
-	ChannelRepository *channelDb.SQLiteChannelRepository
-	VideoRepository   *videoDb.SQLiteVideoRepository
+	ChannelRepository  *channelDb.SQLiteChannelRepository
+	VideoRepository    *videoDb.SQLiteVideoRepository
+	TokenRepository    *tokenDb.SQLiteTokenRepository
+	SyncRunRepository  *runDb.SQLiteSyncRunRepository
+	PlaylistRepository *playlistDb.SQLitePlaylistRepository
+	MetadataRepository *metadataDb.SQLiteMetadataRepository
+	UpcomingRepository *upcomingDb.SQLiteUpcomingVideoRepository
+	db                 *sql.DB
+	// dryRunCopyPath is the path of the throwaway copy of the database used in dry-run mode
+	dryRunCopyPath string
 }
 
 func GetDatabaseServiceInstance() *DatabaseService {
@@ -33,18 +49,85 @@ func GetDatabaseServiceInstance() *DatabaseService {
 func (dbService *DatabaseService) Init() error {
 	// create a connection to the db
 	configuration := config.GetConfigurationServiceInstance().Configuration
-	db, err := sql.Open("sqlite3", configuration.Database)
+	dbPath := configuration.Database
+	if settings.GetSettingsService().DryRun {
+		// nothing must be written in the real database, so the synchronization works on a copy
+		copyPath, err := createDryRunCopy(dbPath)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("can't copy the database: '%s'", dbPath), err)
+		}
+		dbService.dryRunCopyPath = copyPath
+		dbPath = copyPath
+	}
+	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		return utils.WrapError(fmt.Sprintf("can't open the database: '%s'", configuration.Database), err)
+		return utils.WrapError(fmt.Sprintf("can't open the database: '%s'", dbPath), err)
 	}
+	dbService.db = db
 
-	dbService.ChannelRepository = channelDb.NewSQLiteRepository(db)
-	if err := dbService.ChannelRepository.Migrate(); err != nil {
-		return utils.WrapError("Unable to init the 'channel' table", err)
+	// upgrade the schema if needed
+	migrator := migration.NewMigrator(db, dbPath, migration.Migrations)
+	if dbService.dryRunCopyPath != "" {
+		// the copy is deleted once closed, the real database being left untouched
+		migrator.DisableBackup()
 	}
-	dbService.VideoRepository = videoDb.NewSQLiteRepository(db)
-	if err := dbService.VideoRepository.Migrate(); err != nil {
-		return utils.WrapError("Unable to init the 'video' table", err)
+	if err := migrator.Migrate(); err != nil {
+		return utils.WrapError("unable to migrate the database schema", err)
 	}
+
+	dbService.ChannelRepository = channelDb.NewSQLiteRepository(db)
+	dbService.VideoRepository = videoDb.NewSQLiteRepository(db)
+	dbService.TokenRepository = tokenDb.NewSQLiteRepository(db)
+	dbService.SyncRunRepository = runDb.NewSQLiteRepository(db)
+	dbService.PlaylistRepository = playlistDb.NewSQLiteRepository(db)
+	dbService.MetadataRepository = metadataDb.NewSQLiteRepository(db)
+	dbService.UpcomingRepository = upcomingDb.NewSQLiteRepository(db)
 	return nil
 }
+
+// Begin starts a transaction, to be given to the repositories.
+func (dbService *DatabaseService) Begin() (*sql.Tx, error) {
+	return dbService.db.Begin()
+}
+
+// Close closes the connection to the database, and deletes the copy used in dry-run mode.
+func (dbService *DatabaseService) Close() error {
+	if dbService.db == nil {
+		return nil
+	}
+	err := dbService.db.Close()
+	dbService.db = nil
+	if dbService.dryRunCopyPath != "" {
+		if errRemove := os.Remove(dbService.dryRunCopyPath); errRemove != nil && err == nil {
+			err = errRemove
+		}
+		dbService.dryRunCopyPath = ""
+	}
+	return err
+}
+
+// createDryRunCopy copies the database into a temporary file, and returns its path.
+func createDryRunCopy(dbPath string) (string, error) {
+	copyFile, err := os.CreateTemp("", "piped-playfeed-dry-run-*.db")
+	if err != nil {
+		return "", err
+	}
+	copyPath := copyFile.Name()
+	if err := copyFile.Close(); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		// no database yet: start from an empty one
+		return copyPath, nil
+	}
+	source, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	if _, err := source.Exec("VACUUM INTO ?", copyPath); err != nil {
+		_ = os.Remove(copyPath)
+		return "", err
+	}
+	return copyPath, nil
+}
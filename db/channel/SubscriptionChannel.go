@@ -1,6 +1,9 @@
 package channel
 
 type SubscriptionChannel struct {
-	Id            string
-	LastVideoDate string
+	Id string
+	// Name is the last known name of the channel.
+	Name string
+	// LastUploaded is the upload time (in milliseconds) of the newest video seen, 0 if the channel was never indexed.
+	LastUploaded int64
 }
@@ -16,20 +16,16 @@ func NewSQLiteRepository(db *sql.DB) *SQLiteChannelRepository {
 	}
 }
 
-func (r *SQLiteChannelRepository) Migrate() error {
-	query := `
-    CREATE TABLE IF NOT EXISTS subscriptions_channels(
-        id TEXT PRIMARY KEY,
-        lastVideoDate INTEGER
-    );
-    `
-
-	_, err := r.db.Exec(query)
-	return err
+func (r *SQLiteChannelRepository) Create(subscriptionChannel SubscriptionChannel) (*SubscriptionChannel, error) {
+	return r.create(r.db, subscriptionChannel)
 }
 
-func (r *SQLiteChannelRepository) Create(subscriptionChannel SubscriptionChannel) (*SubscriptionChannel, error) {
-	_, err := r.db.Exec("INSERT INTO subscriptions_channels(id, lastVideoDate) values(?, ?)", subscriptionChannel.Id, subscriptionChannel.LastVideoDate)
+func (r *SQLiteChannelRepository) CreateTx(tx *sql.Tx, subscriptionChannel SubscriptionChannel) (*SubscriptionChannel, error) {
+	return r.create(tx, subscriptionChannel)
+}
+
+func (r *SQLiteChannelRepository) create(executor dbCommon.Executor, subscriptionChannel SubscriptionChannel) (*SubscriptionChannel, error) {
+	_, err := executor.Exec("INSERT INTO subscriptions_channels(id, lastUploaded, name) values(?, ?, ?)", subscriptionChannel.Id, subscriptionChannel.LastUploaded, subscriptionChannel.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +36,7 @@ func (r *SQLiteChannelRepository) GetById(id string) (*SubscriptionChannel, erro
 	row := r.db.QueryRow("SELECT * FROM subscriptions_channels WHERE id = ?", id)
 
 	var subscriptionChannel SubscriptionChannel
-	if err := row.Scan(&subscriptionChannel.Id, &subscriptionChannel.LastVideoDate); err != nil {
+	if err := row.Scan(&subscriptionChannel.Id, &subscriptionChannel.LastUploaded, &subscriptionChannel.Name); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, dbCommon.ErrNotExists
 		}
@@ -50,10 +46,18 @@ func (r *SQLiteChannelRepository) GetById(id string) (*SubscriptionChannel, erro
 }
 
 func (r *SQLiteChannelRepository) Update(id string, updated SubscriptionChannel) (*SubscriptionChannel, error) {
+	return r.update(r.db, id, updated)
+}
+
+func (r *SQLiteChannelRepository) UpdateTx(tx *sql.Tx, id string, updated SubscriptionChannel) (*SubscriptionChannel, error) {
+	return r.update(tx, id, updated)
+}
+
+func (r *SQLiteChannelRepository) update(executor dbCommon.Executor, id string, updated SubscriptionChannel) (*SubscriptionChannel, error) {
 	if len(id) == 0 {
 		return nil, errors.New("invalid updated ID")
 	}
-	res, err := r.db.Exec("UPDATE subscriptions_channels SET lastVideoDate = ? WHERE id = ?", updated.LastVideoDate, updated.Id)
+	res, err := executor.Exec("UPDATE subscriptions_channels SET lastUploaded = ?, name = ? WHERE id = ?", updated.LastUploaded, updated.Name, updated.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +74,12 @@ func (r *SQLiteChannelRepository) Update(id string, updated SubscriptionChannel)
 	return &updated, nil
 }
 
+// Rename updates the name of a channel, if known.
+func (r *SQLiteChannelRepository) Rename(id string, name string) error {
+	_, err := r.db.Exec("UPDATE subscriptions_channels SET name = ? WHERE id = ? AND name != ?", name, id, name)
+	return err
+}
+
 //func (r *SQLiteRepository) Delete(id string) error {
 //	res, err := r.db.Exec("DELETE FROM subscriptions_channels WHERE id = ?", id)
 //	if err != nil {
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"database/sql"
 	"errors"
 )
 
@@ -9,3 +10,11 @@ var (
 	ErrNotExists    = errors.New("row not exists")
 	ErrUpdateFailed = errors.New("update failed")
 )
+
+// Executor is implemented by both *sql.DB and *sql.Tx, so that the repositories run their queries either directly or
+// as part of a transaction.
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
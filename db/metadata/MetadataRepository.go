@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"database/sql"
+	"errors"
+	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+)
+
+type SQLiteMetadataRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteMetadataRepository {
+	return &SQLiteMetadataRepository{
+		db: db,
+	}
+}
+
+// Save creates or replaces the metadata of a video.
+//
+// The view count at index time is kept, and so is the shorts flag which the details may miss. The metadata
+// coming from the details of a video are never replaced by the ones coming from a listing.
+func (r *SQLiteMetadataRepository) Save(videoMetadata VideoMetadata) (*VideoMetadata, error) {
+	return r.save(r.db, videoMetadata)
+}
+
+func (r *SQLiteMetadataRepository) SaveTx(tx *sql.Tx, videoMetadata VideoMetadata) (*VideoMetadata, error) {
+	return r.save(tx, videoMetadata)
+}
+
+func (r *SQLiteMetadataRepository) save(executor dbCommon.Executor, videoMetadata VideoMetadata) (*VideoMetadata, error) {
+	_, err := executor.Exec(`INSERT INTO videos_metadata(id, title, uploader, uploaderId, duration, thumbnailUrl, category, short, livestream, views, description, detailed)
+            values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT(id) DO UPDATE SET title = excluded.title, uploader = excluded.uploader, uploaderId = excluded.uploaderId,
+                duration = excluded.duration, thumbnailUrl = excluded.thumbnailUrl, category = excluded.category,
+                short = max(short, excluded.short), livestream = excluded.livestream, description = excluded.description,
+                detailed = excluded.detailed
+            WHERE excluded.detailed = 1 OR detailed = 0`,
+		videoMetadata.Id, videoMetadata.Title, videoMetadata.Uploader, videoMetadata.UploaderId, videoMetadata.Duration,
+		videoMetadata.ThumbnailUrl, videoMetadata.Category, videoMetadata.Short, videoMetadata.Livestream, videoMetadata.Views,
+		videoMetadata.Description, videoMetadata.Detailed)
+	if err != nil {
+		return nil, err
+	}
+	return &videoMetadata, nil
+}
+
+func (r *SQLiteMetadataRepository) GetById(id string) (*VideoMetadata, error) {
+	row := r.db.QueryRow("SELECT id, title, uploader, uploaderId, duration, thumbnailUrl, category, short, livestream, views, description, detailed FROM videos_metadata WHERE id = ?", id)
+
+	var videoMetadata VideoMetadata
+	if err := row.Scan(&videoMetadata.Id, &videoMetadata.Title, &videoMetadata.Uploader, &videoMetadata.UploaderId, &videoMetadata.Duration,
+		&videoMetadata.ThumbnailUrl, &videoMetadata.Category, &videoMetadata.Short, &videoMetadata.Livestream, &videoMetadata.Views,
+		&videoMetadata.Description, &videoMetadata.Detailed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, dbCommon.ErrNotExists
+		}
+		return nil, err
+	}
+	return &videoMetadata, nil
+}
+
+// GetIdsToBackfill returns up to limit ids of known videos whose metadata don't come from their details yet, the
+// newest first.
+func (r *SQLiteMetadataRepository) GetIdsToBackfill(limit int) (*[]string, error) {
+	rows, err := r.db.Query(`SELECT id FROM subscriptions_videos
+            WHERE id NOT IN (SELECT id FROM videos_metadata WHERE detailed = 1)
+            GROUP BY id ORDER BY max(uploaded) DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return &ids, rows.Err()
+}
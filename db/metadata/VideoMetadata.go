@@ -0,0 +1,21 @@
+package metadata
+
+// VideoMetadata represents the metadata of a video, whatever its buckets.
+type VideoMetadata struct {
+	Id         string
+	Title      string
+	Uploader   string
+	UploaderId string
+	// Duration is in seconds.
+	Duration     int64
+	ThumbnailUrl string
+	Category     string
+	Short        bool
+	Livestream   bool
+	// Views is the view count when the video has been indexed.
+	Views int64
+	// Description is the beginning of the description of the video.
+	Description string
+	// Detailed tells that the metadata come from the video details, the listings missing some of them.
+	Detailed bool
+}
@@ -0,0 +1,145 @@
+// Package migration provides the versioned migrations of the database schema.
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	"os"
+	"time"
+)
+
+// Migration represents an evolution of the database schema.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// Migrator applies the missing migrations on a database.
+type Migrator struct {
+	db         *sql.DB
+	dbPath     string
+	migrations []Migration
+	// noBackup disables the backup of the database before migrating it
+	noBackup bool
+}
+
+// NewMigrator creates a migrator for the database located at dbPath, using the migrations ordered by version.
+func NewMigrator(db *sql.DB, dbPath string, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		dbPath:     dbPath,
+		migrations: migrations,
+	}
+}
+
+// DisableBackup prevents the database from being saved before being migrated, like a throwaway copy of a database.
+func (migrator *Migrator) DisableBackup() {
+	migrator.noBackup = true
+}
+
+// LatestVersion returns the version of the schema once all the migrations are applied.
+func (migrator *Migrator) LatestVersion() int {
+	if len(migrator.migrations) == 0 {
+		return 0
+	}
+	return migrator.migrations[len(migrator.migrations)-1].Version
+}
+
+// CurrentVersion returns the version of the database schema, 0 if no migration has been applied yet.
+func (migrator *Migrator) CurrentVersion() (int, error) {
+	_, err := migrator.db.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_version(
+        version INTEGER PRIMARY KEY,
+        description TEXT,
+        appliedAt TEXT
+    );
+    `)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	if err := migrator.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate applies the missing migrations, each one in its own transaction, after a single backup of the database.
+//
+// Error is returned if the database has been written by a newer version of the application.
+func (migrator *Migrator) Migrate() error {
+	currentVersion, err := migrator.CurrentVersion()
+	if err != nil {
+		return utils.WrapError("unable to read the schema version", err)
+	}
+	if currentVersion > migrator.LatestVersion() {
+		return fmt.Errorf("the database schema (v%d) is newer than the supported one (v%d): upgrade the application", currentVersion, migrator.LatestVersion())
+	}
+	if currentVersion == migrator.LatestVersion() {
+		return nil
+	}
+	empty, err := migrator.isEmpty()
+	if err != nil {
+		return utils.WrapError("unable to inspect the database", err)
+	}
+	if !empty && !migrator.noBackup {
+		// a brand-new database is not worth a backup
+		if err := migrator.backup(currentVersion); err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to backup the database before migrating it from v%d", currentVersion), err)
+		}
+	}
+	for _, migration := range migrator.migrations {
+		if migration.Version <= currentVersion {
+			continue
+		}
+		utils.GetLoggingService().Info(fmt.Sprintf("Migrating the database to v%d: %s", migration.Version, migration.Description))
+		if err := migrator.apply(migration); err != nil {
+			return utils.WrapError(fmt.Sprintf("migration v%d failed (%s)", migration.Version, migration.Description), err)
+		}
+		currentVersion = migration.Version
+	}
+	return nil
+}
+
+// isEmpty tells if the database doesn't contain any table yet, except the schema versions.
+func (migrator *Migrator) isEmpty() (bool, error) {
+	var count int
+	err := migrator.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_version'").Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func (migrator *Migrator) apply(migration Migration) error {
+	tx, err := migrator.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := migration.Up(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO schema_version(version, description, appliedAt) values(?, ?, ?)", migration.Version, migration.Description, time.Now().Format(time.RFC3339))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// backup copies the database next to it, before migrating it from the given version.
+func (migrator *Migrator) backup(version int) error {
+	if _, err := os.Stat(migrator.dbPath); err != nil {
+		// in-memory database
+		return nil
+	}
+	backupPath := fmt.Sprintf("%s.backup-v%d-%s", migrator.dbPath, version, time.Now().Format("20060102T150405"))
+	if _, err := migrator.db.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return err
+	}
+	utils.GetLoggingService().Info(fmt.Sprintf("Database saved to '%s'", backupPath))
+	return nil
+}
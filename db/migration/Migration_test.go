@@ -0,0 +1,179 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func openTestDatabase(t *testing.T) (*sql.DB, string) {
+	dir := t.TempDir()
+	utils.GetLoggingService().InitializeLogger(filepath.Join(dir, "piped-playfeed-log.json"), true, false, func() {})
+	dbPath := filepath.Join(dir, "piped-playfeed.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("unable to open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dbPath
+}
+
+func execTest(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("unable to run '%s': %v", query, err)
+	}
+}
+
+// queryStrings returns the rows of a query as strings, its columns being separated by '|'.
+func queryStrings(t *testing.T, db *sql.DB, query string) []string {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("unable to run '%s': %v", query, err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var result []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatalf("unable to scan '%s': %v", query, err)
+		}
+		fields := make([]string, len(values))
+		for i, value := range values {
+			if bytes, ok := value.([]byte); ok {
+				value = string(bytes)
+			}
+			fields[i] = fmt.Sprint(value)
+		}
+		result = append(result, strings.Join(fields, "|"))
+	}
+	return result
+}
+
+func assertRows(t *testing.T, db *sql.DB, query string, expected ...string) {
+	t.Helper()
+	actual := queryStrings(t, db, query)
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected rows for '%s'\nexpected: %v\nactual:   %v", query, expected, actual)
+	}
+}
+
+func TestMigrateOldDatabase(t *testing.T) {
+	db, dbPath := openTestDatabase(t)
+
+	// a database of the first versions, storing the channels cursor as a day and the videos by playlist name
+	if err := NewMigrator(db, dbPath, Migrations[:1]).Migrate(); err != nil {
+		t.Fatalf("unable to create the v1 database: %v", err)
+	}
+	execTest(t, db, "INSERT INTO subscriptions_channels(id, lastVideoDate) VALUES ('UC1', '2023-01-31'), ('UC2', NULL)")
+	execTest(t, db, `INSERT INTO subscriptions_videos(id, uploadDate, uploaded, removed, playlist) VALUES
+        ('a', '2023-01-31', 1675123200000, 0, 'PF - 2023 January'),
+        ('b', '2023-02-01', 1675209600000, 1, 'PF - 2023 Week 5'),
+        ('c', '2023-02-02', 1675296000000, 0, 'My playlist'),
+        ('d', '2023-02-03', 1675382400000, 0, NULL)`)
+
+	// an interrupted synchronization, tracked since v3
+	if err := NewMigrator(db, dbPath, Migrations[:3]).Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database to v3: %v", err)
+	}
+	execTest(t, db, "INSERT INTO sync_runs(id, startedAt) VALUES (1, '2023-02-03T10:00:00Z')")
+	execTest(t, db, "INSERT INTO sync_run_playlists(runId, playlist, pushed) VALUES (1, 'PF - 2023 Week 5', 0), (1, 'Other', 1)")
+
+	migrator := NewMigrator(db, dbPath, Migrations)
+	if err := migrator.Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database: %v", err)
+	}
+
+	// v2 and v4: the day cursor is converted into the timestamp of the start of the day
+	assertRows(t, db, "SELECT id, lastUploaded, name FROM subscriptions_channels ORDER BY id",
+		"UC1|1675123200000|", "UC2|0|")
+	// v5: the playlist names generated by the former versions are converted into buckets, the other ones are kept
+	assertRows(t, db, "SELECT id, uploadDate, uploaded, removed, bucket FROM subscriptions_videos ORDER BY id",
+		"a|2023-01-31|1675123200000|0|month:2023-01",
+		"b|2023-02-01|1675209600000|1|week:2023-W05",
+		"c|2023-02-02|1675296000000|0|My playlist",
+		"d|2023-02-03|1675382400000|0|")
+	assertRows(t, db, "SELECT runId, bucket, pushed FROM sync_run_buckets ORDER BY bucket",
+		"1|Other|1", "1|week:2023-W05|0")
+	assertRows(t, db, "SELECT version FROM schema_version ORDER BY version",
+		"1", "2", "3", "4", "5", "6", "7", "8", "9")
+
+	// a single backup per migration batch, named after the version it starts from
+	backups, err := filepath.Glob(dbPath + ".backup-*")
+	if err != nil {
+		t.Fatalf("unable to list the backups: %v", err)
+	}
+	sort.Strings(backups)
+	if len(backups) != 2 || !strings.HasPrefix(backups[0], dbPath+".backup-v1-") || !strings.HasPrefix(backups[1], dbPath+".backup-v3-") {
+		t.Fatalf("unexpected backups: %v", backups)
+	}
+	backup, err := sql.Open("sqlite3", backups[1])
+	if err != nil {
+		t.Fatalf("unable to open the backup: %v", err)
+	}
+	defer backup.Close()
+	assertRows(t, backup, "SELECT MAX(version) FROM schema_version", "3")
+	assertRows(t, backup, "SELECT playlist FROM sync_run_playlists ORDER BY playlist", "Other", "PF - 2023 Week 5")
+
+	// nothing left to migrate
+	if err := migrator.Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database again: %v", err)
+	}
+	if again, _ := filepath.Glob(dbPath + ".backup-*"); len(again) != 2 {
+		t.Errorf("unexpected backups once up to date: %v", again)
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	db, dbPath := openTestDatabase(t)
+	migrator := NewMigrator(db, dbPath, Migrations)
+	if err := migrator.Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database: %v", err)
+	}
+	if version, err := migrator.CurrentVersion(); err != nil || version != migrator.LatestVersion() {
+		t.Errorf("unexpected version %d (%v)", version, err)
+	}
+	if backups, _ := filepath.Glob(dbPath + ".backup-*"); len(backups) != 0 {
+		t.Errorf("unexpected backups of a new database: %v", backups)
+	}
+}
+
+func TestMigrateWithoutBackup(t *testing.T) {
+	db, dbPath := openTestDatabase(t)
+	if err := NewMigrator(db, dbPath, Migrations[:1]).Migrate(); err != nil {
+		t.Fatalf("unable to create the v1 database: %v", err)
+	}
+	execTest(t, db, "INSERT INTO subscriptions_channels(id, lastVideoDate) VALUES ('UC1', '2023-01-31')")
+
+	migrator := NewMigrator(db, dbPath, Migrations)
+	migrator.DisableBackup()
+	if err := migrator.Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database: %v", err)
+	}
+	if version, err := migrator.CurrentVersion(); err != nil || version != migrator.LatestVersion() {
+		t.Errorf("unexpected version %d (%v)", version, err)
+	}
+	if backups, _ := filepath.Glob(dbPath + ".backup-*"); len(backups) != 0 {
+		t.Errorf("unexpected backups: %v", backups)
+	}
+}
+
+func TestMigrateNewerDatabase(t *testing.T) {
+	db, dbPath := openTestDatabase(t)
+	if err := NewMigrator(db, dbPath, Migrations).Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database: %v", err)
+	}
+	err := NewMigrator(db, dbPath, Migrations[:len(Migrations)-1]).Migrate()
+	if err == nil || !strings.Contains(err.Error(), "is newer than the supported one") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package migration provides the versioned migrations of the database schema.
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Migrations lists all the migrations of the database schema, ordered by version.
+//
+// A released migration must never be modified: any change of the schema requires a new migration.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		Up: func(tx *sql.Tx) error {
+			// the tables may already exist, created before the versioning of the schema
+			return execAll(tx, `
+            CREATE TABLE IF NOT EXISTS subscriptions_channels(
+                id TEXT PRIMARY KEY,
+                lastVideoDate INTEGER
+            );`, `
+            CREATE TABLE IF NOT EXISTS subscriptions_videos(
+                id TEXT PRIMARY KEY,
+                uploadDate TEXT,
+                uploaded INTEGER,
+                removed INTEGER,
+                playlist TEXT
+            );`, `
+            CREATE TABLE IF NOT EXISTS auth_tokens(
+                instance TEXT,
+                username TEXT,
+                token TEXT,
+                PRIMARY KEY (instance, username)
+            );`)
+		},
+	},
+	{
+		Version:     2,
+		Description: "store the channels last video date as text",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+            CREATE TABLE subscriptions_channels_v2(
+                id TEXT PRIMARY KEY,
+                lastVideoDate TEXT
+            );`, `
+            INSERT INTO subscriptions_channels_v2(id, lastVideoDate)
+            SELECT id, CAST(lastVideoDate AS TEXT) FROM subscriptions_channels;`, `
+            DROP TABLE subscriptions_channels;`, `
+            ALTER TABLE subscriptions_channels_v2 RENAME TO subscriptions_channels;`)
+		},
+	},
+	{
+		Version:     3,
+		Description: "track the progress of the synchronizations",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+            CREATE TABLE sync_runs(
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                startedAt TEXT NOT NULL,
+                finishedAt TEXT
+            );`, `
+            CREATE TABLE sync_run_channels(
+                runId INTEGER NOT NULL,
+                channelId TEXT NOT NULL,
+                PRIMARY KEY (runId, channelId)
+            );`, `
+            CREATE TABLE sync_run_playlists(
+                runId INTEGER NOT NULL,
+                playlist TEXT NOT NULL,
+                pushed INTEGER NOT NULL,
+                PRIMARY KEY (runId, playlist)
+            );`)
+		},
+	},
+	{
+		Version:     4,
+		Description: "store the channels cursor as a timestamp in milliseconds",
+		Up: func(tx *sql.Tx) error {
+			// the former cursor was a day: its start is kept, so that no video of this day is missed
+			return execAll(tx, `
+            CREATE TABLE subscriptions_channels_v4(
+                id TEXT PRIMARY KEY,
+                lastUploaded INTEGER NOT NULL
+            );`, `
+            INSERT INTO subscriptions_channels_v4(id, lastUploaded)
+            SELECT id, COALESCE(unixepoch(lastVideoDate), 0) * 1000 FROM subscriptions_channels;`, `
+            DROP TABLE subscriptions_channels;`, `
+            ALTER TABLE subscriptions_channels_v4 RENAME TO subscriptions_channels;`)
+		},
+	},
+	{
+		Version:     5,
+		Description: "file the videos into buckets rather than playlist names",
+		Up: func(tx *sql.Tx) error {
+			err := execAll(tx, `
+            CREATE TABLE managed_playlists(
+                bucket TEXT PRIMARY KEY,
+                playlistId TEXT NOT NULL,
+                name TEXT NOT NULL
+            );`, `
+            ALTER TABLE subscriptions_videos RENAME COLUMN playlist TO bucket;`, `
+            ALTER TABLE sync_run_playlists RENAME COLUMN playlist TO bucket;`, `
+            ALTER TABLE sync_run_playlists RENAME TO sync_run_buckets;`)
+			if err != nil {
+				return err
+			}
+			if err := convertPlaylistNames(tx, "subscriptions_videos"); err != nil {
+				return err
+			}
+			return convertPlaylistNames(tx, "sync_run_buckets")
+		},
+	},
+	{
+		Version:     6,
+		Description: "store the channels name",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+            ALTER TABLE subscriptions_channels ADD COLUMN name TEXT NOT NULL DEFAULT '';`)
+		},
+	},
+	{
+		Version:     7,
+		Description: "file a video into several buckets",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+            CREATE TABLE subscriptions_videos_v7(
+                id TEXT NOT NULL,
+                uploadDate TEXT,
+                uploaded INTEGER,
+                removed INTEGER,
+                bucket TEXT NOT NULL,
+                PRIMARY KEY (id, bucket)
+            );`, `
+            INSERT INTO subscriptions_videos_v7(id, uploadDate, uploaded, removed, bucket)
+            SELECT id, uploadDate, uploaded, removed, COALESCE(bucket, '') FROM subscriptions_videos;`, `
+            DROP TABLE subscriptions_videos;`, `
+            ALTER TABLE subscriptions_videos_v7 RENAME TO subscriptions_videos;`)
+		},
+	},
+	{
+		Version:     8,
+		Description: "store the metadata of the videos",
+		Up: func(tx *sql.Tx) error {
+			// the known videos have no metadata yet, they are backfilled little by little by the synchronizations
+			return execAll(tx, `
+            CREATE TABLE videos_metadata(
+                id TEXT PRIMARY KEY,
+                title TEXT NOT NULL,
+                uploader TEXT NOT NULL,
+                uploaderId TEXT NOT NULL,
+                duration INTEGER NOT NULL,
+                thumbnailUrl TEXT NOT NULL,
+                category TEXT NOT NULL,
+                short INTEGER NOT NULL,
+                livestream INTEGER NOT NULL,
+                views INTEGER NOT NULL,
+                description TEXT NOT NULL,
+                detailed INTEGER NOT NULL
+            );`)
+		},
+	},
+	{
+		Version:     9,
+		Description: "track the upcoming videos",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+            CREATE TABLE upcoming_videos(
+                id TEXT PRIMARY KEY,
+                channelId TEXT NOT NULL,
+                scheduled INTEGER NOT NULL,
+                livestream INTEGER NOT NULL
+            );`)
+		},
+	},
+}
+
+var (
+	legacyMonthPlaylistRegexp = regexp.MustCompile(`^.*(\d{4}) (January|February|March|April|May|June|July|August|September|October|November|December)$`)
+	legacyWeekPlaylistRegexp  = regexp.MustCompile(`^.*(\d{4}) Week (\d{1,2})$`)
+)
+
+// convertPlaylistNames replaces the playlist names generated by the former versions with the matching bucket ids.
+//
+// The names which don't match any generated name are kept as is, and handled as legacy buckets.
+func convertPlaylistNames(tx *sql.Tx, table string) error {
+	rows, err := tx.Query("SELECT DISTINCT bucket FROM " + table + " WHERE bucket IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		bucket := legacyPlaylistBucket(name)
+		if bucket == name {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE "+table+" SET bucket = ? WHERE bucket = ?", bucket, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyPlaylistBucket returns the bucket id matching a playlist name generated by the former versions, like
+// 'PF - 2023 January' or 'PF - 2023 Week 5', or the name itself if it doesn't match.
+//
+// The ids are frozen here rather than computed by the bucket package, so that the migration never changes.
+func legacyPlaylistBucket(name string) string {
+	if match := legacyMonthPlaylistRegexp.FindStringSubmatch(name); match != nil {
+		month, _ := time.Parse("January", match[2])
+		return fmt.Sprintf("month:%s-%02d", match[1], int(month.Month()))
+	}
+	if match := legacyWeekPlaylistRegexp.FindStringSubmatch(name); match != nil {
+		week, _ := strconv.Atoi(match[2])
+		return fmt.Sprintf("week:%s-W%02d", match[1], week)
+	}
+	return name
+}
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package playlist
+
+// ManagedPlaylist represents a playlist of the Piped instance managed by the application, along with its bucket.
+type ManagedPlaylist struct {
+	Bucket     string
+	PlaylistId string
+	// Name is the name given to the playlist by the application.
+	Name string
+}
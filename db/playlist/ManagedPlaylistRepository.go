@@ -0,0 +1,46 @@
+package playlist
+
+import (
+	"database/sql"
+)
+
+type SQLitePlaylistRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLitePlaylistRepository {
+	return &SQLitePlaylistRepository{
+		db: db,
+	}
+}
+
+func (r *SQLitePlaylistRepository) GetAll() (*[]ManagedPlaylist, error) {
+	rows, err := r.db.Query("SELECT bucket, playlistId, name FROM managed_playlists")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var playlists []ManagedPlaylist
+	for rows.Next() {
+		var playlist ManagedPlaylist
+		if err := rows.Scan(&playlist.Bucket, &playlist.PlaylistId, &playlist.Name); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return &playlists, rows.Err()
+}
+
+func (r *SQLitePlaylistRepository) Save(playlist ManagedPlaylist) (*ManagedPlaylist, error) {
+	_, err := r.db.Exec("INSERT OR REPLACE INTO managed_playlists(bucket, playlistId, name) values(?, ?, ?)", playlist.Bucket, playlist.PlaylistId, playlist.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+func (r *SQLitePlaylistRepository) Delete(bucket string) error {
+	_, err := r.db.Exec("DELETE FROM managed_playlists WHERE bucket = ?", bucket)
+	return err
+}
@@ -0,0 +1,9 @@
+package run
+
+// SyncRun represents a synchronization, persisted so that an interrupted one can be resumed by the next run.
+type SyncRun struct {
+	Id        int64
+	StartedAt string
+	// FinishedAt is empty while the synchronization is not completed.
+	FinishedAt string
+}
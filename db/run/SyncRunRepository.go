@@ -0,0 +1,128 @@
+package run
+
+import (
+	"database/sql"
+	"errors"
+	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+	"time"
+)
+
+type SQLiteSyncRunRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteSyncRunRepository {
+	return &SQLiteSyncRunRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteSyncRunRepository) Create() (*SyncRun, error) {
+	syncRun := SyncRun{StartedAt: time.Now().Format(time.RFC3339)}
+	res, err := r.db.Exec("INSERT INTO sync_runs(startedAt) values(?)", syncRun.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	syncRun.Id, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &syncRun, nil
+}
+
+// GetUnfinished returns the last synchronization which has not been completed.
+func (r *SQLiteSyncRunRepository) GetUnfinished() (*SyncRun, error) {
+	row := r.db.QueryRow("SELECT id, startedAt FROM sync_runs WHERE finishedAt IS NULL ORDER BY id DESC LIMIT 1")
+
+	var syncRun SyncRun
+	if err := row.Scan(&syncRun.Id, &syncRun.StartedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, dbCommon.ErrNotExists
+		}
+		return nil, err
+	}
+	return &syncRun, nil
+}
+
+// Finish completes the synchronization, forgetting its progress which is no longer needed.
+func (r *SQLiteSyncRunRepository) Finish(runId int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// the older synchronizations are completed too: they were resumed by this one
+	if _, err := tx.Exec("UPDATE sync_runs SET finishedAt = ? WHERE id <= ? AND finishedAt IS NULL", time.Now().Format(time.RFC3339), runId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sync_run_channels WHERE runId <= ?", runId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sync_run_buckets WHERE runId <= ?", runId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteSyncRunRepository) SetChannelIndexedTx(tx *sql.Tx, runId int64, channelId string) error {
+	_, err := tx.Exec("INSERT OR IGNORE INTO sync_run_channels(runId, channelId) values(?, ?)", runId, channelId)
+	return err
+}
+
+func (r *SQLiteSyncRunRepository) GetIndexedChannels(runId int64) (map[string]struct{}, error) {
+	rows, err := r.db.Query("SELECT channelId FROM sync_run_channels WHERE runId = ?", runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channelIds := make(map[string]struct{})
+	for rows.Next() {
+		var channelId string
+		if err := rows.Scan(&channelId); err != nil {
+			return nil, err
+		}
+		channelIds[channelId] = struct{}{}
+	}
+	return channelIds, rows.Err()
+}
+
+// SetBucketDirty records that the playlist of the bucket has to be pushed to the Piped instance.
+func (r *SQLiteSyncRunRepository) SetBucketDirty(runId int64, bucket string) error {
+	return r.setBucketDirty(r.db, runId, bucket)
+}
+
+func (r *SQLiteSyncRunRepository) SetBucketDirtyTx(tx *sql.Tx, runId int64, bucket string) error {
+	return r.setBucketDirty(tx, runId, bucket)
+}
+
+func (r *SQLiteSyncRunRepository) setBucketDirty(executor dbCommon.Executor, runId int64, bucket string) error {
+	_, err := executor.Exec("INSERT INTO sync_run_buckets(runId, bucket, pushed) values(?, ?, 0) "+
+		"ON CONFLICT(runId, bucket) DO UPDATE SET pushed = 0", runId, bucket)
+	return err
+}
+
+// SetBucketPushed records that the playlist of the bucket is up-to-date on the Piped instance.
+func (r *SQLiteSyncRunRepository) SetBucketPushed(runId int64, bucket string) error {
+	_, err := r.db.Exec("UPDATE sync_run_buckets SET pushed = 1 WHERE runId = ? AND bucket = ?", runId, bucket)
+	return err
+}
+
+// GetDirtyBuckets returns the buckets whose playlist still has to be pushed to the Piped instance.
+func (r *SQLiteSyncRunRepository) GetDirtyBuckets(runId int64) (*[]string, error) {
+	rows, err := r.db.Query("SELECT bucket FROM sync_run_buckets WHERE runId = ? AND pushed = 0 ORDER BY bucket", runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []string
+	for rows.Next() {
+		var bucket string
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return &buckets, rows.Err()
+}
@@ -0,0 +1,7 @@
+package token
+
+type AuthToken struct {
+	Instance string
+	Username string
+	Token    string
+}
@@ -0,0 +1,38 @@
+package token
+
+import (
+	"database/sql"
+	"errors"
+	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+)
+
+type SQLiteTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteTokenRepository {
+	return &SQLiteTokenRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteTokenRepository) GetByAccount(instance string, username string) (*AuthToken, error) {
+	row := r.db.QueryRow("SELECT instance, username, token FROM auth_tokens WHERE instance = ? AND username = ?", instance, username)
+
+	var authToken AuthToken
+	if err := row.Scan(&authToken.Instance, &authToken.Username, &authToken.Token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, dbCommon.ErrNotExists
+		}
+		return nil, err
+	}
+	return &authToken, nil
+}
+
+func (r *SQLiteTokenRepository) Save(authToken AuthToken) (*AuthToken, error) {
+	_, err := r.db.Exec("INSERT OR REPLACE INTO auth_tokens(instance, username, token) values(?, ?, ?)", authToken.Instance, authToken.Username, authToken.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &authToken, nil
+}
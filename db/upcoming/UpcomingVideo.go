@@ -0,0 +1,12 @@
+package upcoming
+
+// UpcomingVideo represents a video of a channel which is not published yet: a scheduled premiere or livestream, or a
+// livestream still on air.
+type UpcomingVideo struct {
+	Id        string
+	ChannelId string
+	// Scheduled is the expected publication time in milliseconds, or the last time the video has been listed if later.
+	Scheduled int64
+	// Livestream tells that the video has been seen on air, so that it is published as the VOD of a livestream.
+	Livestream bool
+}
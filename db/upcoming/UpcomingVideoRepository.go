@@ -0,0 +1,67 @@
+package upcoming
+
+import (
+	"database/sql"
+	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+)
+
+type SQLiteUpcomingVideoRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteUpcomingVideoRepository {
+	return &SQLiteUpcomingVideoRepository{
+		db: db,
+	}
+}
+
+// Save creates or updates an upcoming video, a video once seen on air staying a livestream.
+func (r *SQLiteUpcomingVideoRepository) Save(upcomingVideo UpcomingVideo) (*UpcomingVideo, error) {
+	return r.save(r.db, upcomingVideo)
+}
+
+func (r *SQLiteUpcomingVideoRepository) SaveTx(tx *sql.Tx, upcomingVideo UpcomingVideo) (*UpcomingVideo, error) {
+	return r.save(tx, upcomingVideo)
+}
+
+func (r *SQLiteUpcomingVideoRepository) save(executor dbCommon.Executor, upcomingVideo UpcomingVideo) (*UpcomingVideo, error) {
+	_, err := executor.Exec(`INSERT INTO upcoming_videos(id, channelId, scheduled, livestream) values(?, ?, ?, ?)
+            ON CONFLICT(id) DO UPDATE SET channelId = excluded.channelId, scheduled = excluded.scheduled,
+                livestream = max(livestream, excluded.livestream)`,
+		upcomingVideo.Id, upcomingVideo.ChannelId, upcomingVideo.Scheduled, upcomingVideo.Livestream)
+	if err != nil {
+		return nil, err
+	}
+	return &upcomingVideo, nil
+}
+
+func (r *SQLiteUpcomingVideoRepository) GetAll() (*[]UpcomingVideo, error) {
+	rows, err := r.db.Query("SELECT id, channelId, scheduled, livestream FROM upcoming_videos ORDER BY scheduled")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var upcomingVideos []UpcomingVideo
+	for rows.Next() {
+		var upcomingVideo UpcomingVideo
+		if err := rows.Scan(&upcomingVideo.Id, &upcomingVideo.ChannelId, &upcomingVideo.Scheduled, &upcomingVideo.Livestream); err != nil {
+			return nil, err
+		}
+		upcomingVideos = append(upcomingVideos, upcomingVideo)
+	}
+	return &upcomingVideos, rows.Err()
+}
+
+func (r *SQLiteUpcomingVideoRepository) Delete(id string) error {
+	return r.delete(r.db, id)
+}
+
+func (r *SQLiteUpcomingVideoRepository) DeleteTx(tx *sql.Tx, id string) error {
+	return r.delete(tx, id)
+}
+
+func (r *SQLiteUpcomingVideoRepository) delete(executor dbCommon.Executor, id string) error {
+	_, err := executor.Exec("DELETE FROM upcoming_videos WHERE id = ?", id)
+	return err
+}
@@ -5,5 +5,6 @@ type SubscriptionVideo struct {
 	UploadDate string
 	Uploaded   int64
 	Removed    int
-	Playlist   string
+	// Bucket is the id of the bucket the video is filed into, see the bucket package.
+	Bucket string
 }
@@ -3,9 +3,7 @@ package video
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	dbCommon "github.com/frajibe/piped-playfeed/db/common"
-	"strings"
 )
 
 type SQLiteVideoRepository struct {
@@ -18,31 +16,33 @@ func NewSQLiteRepository(db *sql.DB) *SQLiteVideoRepository {
 	}
 }
 
-func (r *SQLiteVideoRepository) Migrate() error {
-	query := `
-    CREATE TABLE IF NOT EXISTS subscriptions_videos(
-        id TEXT PRIMARY KEY,
-        uploadDate TEXT,
-        uploaded INTEGER,
-        removed INTEGER,
-        playlist TEXT
-    );
-    `
+func (r *SQLiteVideoRepository) Create(subscriptionVideo SubscriptionVideo) (*SubscriptionVideo, error) {
+	return r.create(r.db, subscriptionVideo)
+}
 
-	_, err := r.db.Exec(query)
-	return err
+func (r *SQLiteVideoRepository) CreateTx(tx *sql.Tx, subscriptionVideo SubscriptionVideo) (*SubscriptionVideo, error) {
+	return r.create(tx, subscriptionVideo)
 }
 
-func (r *SQLiteVideoRepository) Create(subscriptionVideo SubscriptionVideo) (*SubscriptionVideo, error) {
-	_, err := r.db.Exec("INSERT INTO subscriptions_videos(id, uploadDate, uploaded, removed, playlist) values(?, ?, ?, ?, ?)", subscriptionVideo.Id, subscriptionVideo.UploadDate, subscriptionVideo.Uploaded, subscriptionVideo.Removed, subscriptionVideo.Playlist)
+func (r *SQLiteVideoRepository) create(executor dbCommon.Executor, subscriptionVideo SubscriptionVideo) (*SubscriptionVideo, error) {
+	_, err := executor.Exec("INSERT INTO subscriptions_videos(id, uploadDate, uploaded, removed, bucket) values(?, ?, ?, ?, ?)", subscriptionVideo.Id, subscriptionVideo.UploadDate, subscriptionVideo.Uploaded, subscriptionVideo.Removed, subscriptionVideo.Bucket)
 	if err != nil {
 		return nil, err
 	}
 	return &subscriptionVideo, nil
 }
 
+// Exists tells if a video is known, whatever its buckets.
 func (r *SQLiteVideoRepository) Exists(id string) (bool, error) {
-	if err := r.db.QueryRow("SELECT id FROM subscriptions_videos WHERE id = ?", id).Scan(&id); err != nil {
+	return r.exists(r.db, id)
+}
+
+func (r *SQLiteVideoRepository) ExistsTx(tx *sql.Tx, id string) (bool, error) {
+	return r.exists(tx, id)
+}
+
+func (r *SQLiteVideoRepository) exists(executor dbCommon.Executor, id string) (bool, error) {
+	if err := executor.QueryRow("SELECT id FROM subscriptions_videos WHERE id = ? LIMIT 1", id).Scan(&id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false, nil
 		}
@@ -51,11 +51,12 @@ func (r *SQLiteVideoRepository) Exists(id string) (bool, error) {
 	return true, nil
 }
 
+// GetById returns a video, from any of its buckets.
 func (r *SQLiteVideoRepository) GetById(id string) (*SubscriptionVideo, error) {
-	row := r.db.QueryRow("SELECT * FROM subscriptions_videos WHERE id = ?", id)
+	row := r.db.QueryRow("SELECT * FROM subscriptions_videos WHERE id = ? LIMIT 1", id)
 
 	var subscriptionVideo SubscriptionVideo
-	if err := row.Scan(&subscriptionVideo.Id, &subscriptionVideo.UploadDate, &subscriptionVideo.Uploaded, &subscriptionVideo.Removed, &subscriptionVideo.Playlist); err != nil {
+	if err := row.Scan(&subscriptionVideo.Id, &subscriptionVideo.UploadDate, &subscriptionVideo.Uploaded, &subscriptionVideo.Removed, &subscriptionVideo.Bucket); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, dbCommon.ErrNotExists
 		}
@@ -64,8 +65,8 @@ func (r *SQLiteVideoRepository) GetById(id string) (*SubscriptionVideo, error) {
 	return &subscriptionVideo, nil
 }
 
-func (r *SQLiteVideoRepository) GetByPlaylist(playlistName string) (*[]SubscriptionVideo, error) {
-	rows, err := r.db.Query("SELECT *, unixepoch(uploadDate)*1000 as max_date FROM subscriptions_videos WHERE playlist = ? AND removed = 0 ORDER BY max(uploaded, max_date) DESC", playlistName)
+func (r *SQLiteVideoRepository) GetByBucket(bucket string) (*[]SubscriptionVideo, error) {
+	rows, err := r.db.Query("SELECT *, unixepoch(uploadDate)*1000 as max_date FROM subscriptions_videos WHERE bucket = ? AND removed = 0 ORDER BY max(uploaded, max_date) DESC", bucket)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +76,7 @@ func (r *SQLiteVideoRepository) GetByPlaylist(playlistName string) (*[]Subscript
 	var maxDate int64
 	for rows.Next() {
 		var video SubscriptionVideo
-		if err := rows.Scan(&video.Id, &video.UploadDate, &video.Uploaded, &video.Removed, &video.Playlist, &maxDate); err != nil {
+		if err := rows.Scan(&video.Id, &video.UploadDate, &video.Uploaded, &video.Removed, &video.Bucket, &maxDate); err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, dbCommon.ErrNotExists
 			}
@@ -87,11 +88,88 @@ func (r *SQLiteVideoRepository) GetByPlaylist(playlistName string) (*[]Subscript
 	return &videos, nil
 }
 
-func (r *SQLiteVideoRepository) Update(id string, updated SubscriptionVideo) (*SubscriptionVideo, error) {
+// CountByBucket returns the number of videos filed into a bucket, including the ones marked as removed.
+func (r *SQLiteVideoRepository) CountByBucket(bucket string) (int, error) {
+	return r.countByBucket(r.db, bucket)
+}
+
+func (r *SQLiteVideoRepository) CountByBucketTx(tx *sql.Tx, bucket string) (int, error) {
+	return r.countByBucket(tx, bucket)
+}
+
+func (r *SQLiteVideoRepository) countByBucket(executor dbCommon.Executor, bucket string) (int, error) {
+	var count int
+	if err := executor.QueryRow("SELECT COUNT(*) FROM subscriptions_videos WHERE bucket = ?", bucket).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetTimedByBucket returns the videos of a bucket along with their channel and their duration, in the same order as
+// GetByBucket.
+func (r *SQLiteVideoRepository) GetTimedByBucket(bucket string) (*[]TimedVideo, error) {
+	return r.getTimedByBucket(r.db, bucket)
+}
+
+func (r *SQLiteVideoRepository) GetTimedByBucketTx(tx *sql.Tx, bucket string) (*[]TimedVideo, error) {
+	return r.getTimedByBucket(tx, bucket)
+}
+
+func (r *SQLiteVideoRepository) getTimedByBucket(executor dbCommon.Executor, bucket string) (*[]TimedVideo, error) {
+	rows, err := executor.Query(`SELECT v.id, v.uploadDate, v.uploaded, v.removed, v.bucket, COALESCE(m.uploaderId, ''), COALESCE(m.duration, 0),
+            unixepoch(v.uploadDate)*1000 as max_date
+            FROM subscriptions_videos v LEFT JOIN videos_metadata m ON m.id = v.id
+            WHERE v.bucket = ? AND v.removed = 0 ORDER BY max(v.uploaded, max_date) DESC`, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []TimedVideo
+	var maxDate int64
+	for rows.Next() {
+		var video TimedVideo
+		if err := rows.Scan(&video.Id, &video.UploadDate, &video.Uploaded, &video.Removed, &video.Bucket, &video.ChannelId, &video.Duration, &maxDate); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return &videos, rows.Err()
+}
+
+// GetByBucketPrefix returns all the videos whose bucket id starts with the given prefix, like 'week:'.
+func (r *SQLiteVideoRepository) GetByBucketPrefix(prefix string) (*[]SubscriptionVideo, error) {
+	rows, err := r.db.Query("SELECT * FROM subscriptions_videos WHERE substr(bucket, 1, ?) = ?", len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []SubscriptionVideo
+	for rows.Next() {
+		var video SubscriptionVideo
+		if err := rows.Scan(&video.Id, &video.UploadDate, &video.Uploaded, &video.Removed, &video.Bucket); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return &videos, rows.Err()
+}
+
+// Update updates the video filed into the given bucket, the bucket being possibly changed along.
+func (r *SQLiteVideoRepository) Update(id string, bucket string, updated SubscriptionVideo) (*SubscriptionVideo, error) {
+	return r.update(r.db, id, bucket, updated)
+}
+
+func (r *SQLiteVideoRepository) UpdateTx(tx *sql.Tx, id string, bucket string, updated SubscriptionVideo) (*SubscriptionVideo, error) {
+	return r.update(tx, id, bucket, updated)
+}
+
+func (r *SQLiteVideoRepository) update(executor dbCommon.Executor, id string, bucket string, updated SubscriptionVideo) (*SubscriptionVideo, error) {
 	if len(id) == 0 {
 		return nil, errors.New("invalid updated ID")
 	}
-	res, err := r.db.Exec("UPDATE subscriptions_videos SET uploadDate = ?, uploaded = ?, removed = ?, playlist = ? WHERE id = ?", updated.UploadDate, updated.Uploaded, updated.Removed, updated.Playlist, updated.Id)
+	res, err := executor.Exec("UPDATE subscriptions_videos SET uploadDate = ?, uploaded = ?, removed = ?, bucket = ? WHERE id = ? AND bucket = ?", updated.UploadDate, updated.Uploaded, updated.Removed, updated.Bucket, id, bucket)
 	if err != nil {
 		return nil, err
 	}
@@ -108,17 +186,92 @@ func (r *SQLiteVideoRepository) Update(id string, updated SubscriptionVideo) (*S
 	return &updated, nil
 }
 
-func (r *SQLiteVideoRepository) SetAllRemovedExcept(excludedIds *[]string) error {
-	var excludedIdsStr string
-	if len(*excludedIds) != 0 {
-		excludedIdsStr = fmt.Sprintf("('%v')", strings.Join(*excludedIds, "', '"))
-	} else {
-		excludedIdsStr = "()"
+// GetNotRemovedExcept returns the videos which are not marked as removed, except the given ones (identified by their
+// id and bucket) and the ones of the given buckets.
+func (r *SQLiteVideoRepository) GetNotRemovedExcept(excludedVideos *[]SubscriptionVideo, excludedBuckets *[]string) (*[]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// the temporary tables are discarded along with the transaction
+	defer tx.Rollback()
+	if err := createExclusions(tx, excludedVideos, excludedBuckets); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query("SELECT id FROM subscriptions_videos v WHERE removed = 0 AND " + notExcludedCondition)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return &ids, rows.Err()
+}
+
+// SetAllRemovedExcept marks the videos as removed, except the given ones (identified by their id and bucket) and the
+// ones of the given buckets.
+func (r *SQLiteVideoRepository) SetAllRemovedExcept(excludedVideos *[]SubscriptionVideo, excludedBuckets *[]string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := createExclusions(tx, excludedVideos, excludedBuckets); err != nil {
+		return err
 	}
+	if _, err := tx.Exec("UPDATE subscriptions_videos AS v SET removed = 1 WHERE " + notExcludedCondition); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DROP TABLE temp.excluded_videos"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DROP TABLE temp.excluded_buckets"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notExcludedCondition selects the videos (aliased 'v') missing from the temporary tables filled by createExclusions.
+const notExcludedCondition = `NOT EXISTS (SELECT 1 FROM temp.excluded_videos e WHERE e.id = v.id AND e.bucket = v.bucket)
+            AND v.bucket NOT IN (SELECT bucket FROM temp.excluded_buckets)`
 
-	_, err := r.db.Exec("UPDATE subscriptions_videos SET removed = ? WHERE id NOT IN "+excludedIdsStr, 1)
+// createExclusions fills temporary tables with the excluded videos and buckets.
+//
+// The lists may be too long to be passed as query parameters, SQLite limiting their number.
+// The temporary tables only exist within the connection of the transaction.
+func createExclusions(tx *sql.Tx, excludedVideos *[]SubscriptionVideo, excludedBuckets *[]string) error {
+	if _, err := tx.Exec("CREATE TEMP TABLE excluded_videos(id TEXT NOT NULL, bucket TEXT NOT NULL, PRIMARY KEY(id, bucket))"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("CREATE TEMP TABLE excluded_buckets(bucket TEXT NOT NULL PRIMARY KEY)"); err != nil {
+		return err
+	}
+	videoStatement, err := tx.Prepare("INSERT OR IGNORE INTO temp.excluded_videos(id, bucket) VALUES(?, ?)")
 	if err != nil {
 		return err
 	}
+	defer videoStatement.Close()
+	for _, video := range *excludedVideos {
+		if _, err := videoStatement.Exec(video.Id, video.Bucket); err != nil {
+			return err
+		}
+	}
+	bucketStatement, err := tx.Prepare("INSERT OR IGNORE INTO temp.excluded_buckets(bucket) VALUES(?)")
+	if err != nil {
+		return err
+	}
+	defer bucketStatement.Close()
+	for _, bucket := range *excludedBuckets {
+		if _, err := bucketStatement.Exec(bucket); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,89 @@
+package video_test
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/db/migration"
+	videoDb "github.com/frajibe/piped-playfeed/db/video"
+	"github.com/frajibe/piped-playfeed/utils"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func newTestRepository(t *testing.T) (*videoDb.SQLiteVideoRepository, *sql.DB) {
+	dir := t.TempDir()
+	utils.GetLoggingService().InitializeLogger(filepath.Join(dir, "piped-playfeed-log.json"), true, false, func() {})
+	dbPath := filepath.Join(dir, "piped-playfeed.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("unable to open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migration.NewMigrator(db, dbPath, migration.Migrations).Migrate(); err != nil {
+		t.Fatalf("unable to migrate the database: %v", err)
+	}
+	return videoDb.NewSQLiteRepository(db), db
+}
+
+func TestSetAllRemovedExceptManyVideos(t *testing.T) {
+	repository, db := newTestRepository(t)
+	// more (id, bucket) parameters than SQLite accepts in a single query
+	const count = 40000
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unable to begin a transaction: %v", err)
+	}
+	var kept []videoDb.SubscriptionVideo
+	for i := 0; i < count; i++ {
+		video := videoDb.SubscriptionVideo{Id: fmt.Sprintf("video-%d", i), UploadDate: "2023-01-31", Bucket: "week:2023-W05"}
+		if i%3000 == 0 {
+			video.Bucket = "week:2023-W06"
+		}
+		if _, err := repository.CreateTx(tx, video); err != nil {
+			t.Fatalf("unable to create the video: %v", err)
+		}
+		if i%2000 != 0 {
+			kept = append(kept, video)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+	// a video kept in another bucket is removed all the same
+	kept = append(kept, videoDb.SubscriptionVideo{Id: "video-2000", Bucket: "week:2023-W06"})
+	pendingBuckets := []string{"week:2023-W06"}
+
+	ids, err := repository.GetNotRemovedExcept(&kept, &pendingBuckets)
+	if err != nil {
+		t.Fatalf("unable to read the videos to remove: %v", err)
+	}
+	// the videos 0, 2000, 4000... are not kept, but the ones of the pending bucket are not removed
+	var expected []string
+	for i := 0; i < count; i += 2000 {
+		if i%3000 != 0 {
+			expected = append(expected, fmt.Sprintf("video-%d", i))
+		}
+	}
+	sort.Strings(expected)
+	sort.Strings(*ids)
+	if fmt.Sprint(*ids) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected videos to remove: %v", *ids)
+	}
+
+	if err := repository.SetAllRemovedExcept(&kept, &pendingBuckets); err != nil {
+		t.Fatalf("unable to mark the videos as removed: %v", err)
+	}
+	var removed int
+	if err := db.QueryRow("SELECT count(*) FROM subscriptions_videos WHERE removed = 1").Scan(&removed); err != nil {
+		t.Fatalf("unable to count the removed videos: %v", err)
+	}
+	if removed != len(expected) {
+		t.Errorf("unexpected number of removed videos: %d", removed)
+	}
+	// the temporary tables don't outlive the calls
+	if err := repository.SetAllRemovedExcept(&kept, &pendingBuckets); err != nil {
+		t.Errorf("unable to mark the videos as removed twice: %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+package video
+
+// TimedVideo represents a video along with its channel and its duration, as known from its metadata.
+type TimedVideo struct {
+	SubscriptionVideo
+	// ChannelId is empty and Duration is 0 (in seconds) if unknown.
+	ChannelId string
+	Duration  int64
+}
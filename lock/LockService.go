@@ -4,19 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"github.com/frajibe/piped-playfeed/utils"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const lockFile = "piped-playfeed.lock"
 
+// CreateLockFile creates the lock file, containing the PID of the current process.
+//
+// A lock file left by a process which is not running anymore (crash, kill) is replaced.
 func CreateLockFile() error {
-	if _, err := os.Stat(lockFile); err == nil {
-		msg := fmt.Sprintf("'%s' file is present.\n"+
-			"- Reason 1: the application is already running -> wait for its end and retry.\n"+
-			"- Reason 2: the previous run failed -> check the log file to understand why, and then delete the lock file.", lockFile)
-		return errors.New(msg)
+	err := writeLockFile()
+	if errors.Is(err, fs.ErrExist) {
+		if !isStale() {
+			msg := fmt.Sprintf("'%s' file is present.\n"+
+				"- Reason 1: the application is already running -> wait for its end and retry.\n"+
+				"- Reason 2: the previous run failed -> check the log file to understand why, and then delete the lock file.", lockFile)
+			return errors.New(msg)
+		}
+		utils.GetLoggingService().Warn(fmt.Sprintf("'%s' file left by a previous run which is not running anymore, replacing it", lockFile))
+		if err = os.Remove(lockFile); err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to delete the stale lock file '%s'", lockFile), err)
+		}
+		err = writeLockFile()
 	}
-	if _, err := os.Create(lockFile); err != nil {
+	if err != nil {
 		return utils.WrapError(fmt.Sprintf("invalid location '%s'", lockFile), err)
 	}
 	return nil
@@ -28,3 +42,32 @@ func DeleteLockFile() error {
 	}
 	return nil
 }
+
+func writeLockFile() error {
+	// O_EXCL: two processes starting at the same time can't both get the lock
+	file, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isStale tells if the existing lock file has been left by a process which is not running anymore.
+//
+// Lock files without a PID (created by older versions) are never considered as stale.
+func isStale() bool {
+	content, err := os.ReadFile(lockFile)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	// in a container, the restarted application usually gets the PID of the crashed one
+	return pid == os.Getpid() || !isProcessRunning(pid)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package lock
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isProcessRunning tells if a process exists with the given PID.
+func isProcessRunning(pid int) bool {
+	// the signal 0 only checks the existence of the process, EPERM meaning that it belongs to another user
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
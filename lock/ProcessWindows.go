@@ -0,0 +1,16 @@
+//go:build windows
+
+package lock
+
+import "os"
+
+// isProcessRunning tells if a process exists with the given PID.
+func isProcessRunning(pid int) bool {
+	// on Windows, the process is opened, failing if it doesn't exist
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
@@ -1,22 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/frajibe/piped-playfeed/config"
+	"github.com/frajibe/piped-playfeed/config/model"
 	"github.com/frajibe/piped-playfeed/db"
+	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+	tokenDb "github.com/frajibe/piped-playfeed/db/token"
 	"github.com/frajibe/piped-playfeed/lock"
 	pipedApi "github.com/frajibe/piped-playfeed/piped/api"
+	"github.com/frajibe/piped-playfeed/scheduler"
 	"github.com/frajibe/piped-playfeed/settings"
 	"github.com/frajibe/piped-playfeed/sync"
 	"github.com/frajibe/piped-playfeed/utils"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// version is the version of the application, also sent to the Piped instance as part of the user agent.
+const version = "v1.5.0"
+
 var helpFlag = flag.Bool("help", false, "Show help")
+var daemonFlag = flag.Bool("daemon", false, "Action: keep running and synchronize the playlists as scheduled in the configuration")
 var configFlag = flag.String("conf", "piped-playfeed-conf.json", "Provide the path to the configuration file")
+var dryRunFlag = flag.Bool("dry-run", false, "With --sync, print the planned changes without applying them on the Piped instance nor the database")
 var debugFlag = flag.Bool("debug", false, "Enable debug logging")
 var logFlag = flag.String("log", "piped-playfeed-log.json", "Provide the path to the output log file")
+var rebucketFlag = flag.Bool("rebucket", false, "Action: file again the videos of the weekly playlists according to the configured calendar, then synchronize the playlists")
 var silentFlag = flag.Bool("silent", false, "Hide progress in console")
 var syncFlag = flag.Bool("sync", false, "Action: synchronize the playlists accordingly to the subscriptions")
 var versionFlag = flag.Bool("version", false, "Show version")
@@ -46,19 +62,56 @@ func main() {
 	}
 
 	// login
-	err = pipedApi.Login(configuration.Account.Username, configuration.Account.Password, configuration.Instance)
+	ctx := context.Background()
+	clientOptions := pipedApi.ClientOptions{
+		UserAgent: pipedApi.DefaultUserAgent + "/" + version,
+		RetryPolicy: pipedApi.RetryPolicy{
+			MaxAttempts:  configuration.Network.Retry.MaxAttempts,
+			InitialDelay: time.Duration(configuration.Network.Retry.InitialDelayMs) * time.Millisecond,
+			MaxDelay:     time.Duration(configuration.Network.Retry.MaxDelayMs) * time.Millisecond,
+		},
+		CircuitBreakerPolicy: pipedApi.CircuitBreakerPolicy{
+			FailureThreshold: configuration.Network.CircuitBreaker.FailureThreshold,
+			Pause:            time.Duration(configuration.Network.CircuitBreaker.PauseSeconds) * time.Second,
+		},
+		WorkerPool: pipedApi.NewWorkerPool(configuration.Network.Concurrency),
+	}
+	pipedClient := pipedApi.NewClient(configuration.Instance, clientOptions)
+	readClients := []*pipedApi.Client{pipedClient}
+	for _, fallbackInstance := range configuration.FallbackInstances {
+		readClients = append(readClients, pipedApi.NewClient(fallbackInstance, clientOptions))
+	}
+	pipedClient.SetReadPool(pipedApi.NewInstancePool(readClients, configuration.SpreadReads))
+	err = authenticate(ctx, pipedClient, configuration)
 	if err != nil {
 		utils.GetLoggingService().FatalFromError(utils.WrapError("unable to authenticate on the Piped instance", err))
 	}
 
 	// launch the synchronization if requested
-	if settings.GetSettingsService().SynchronizationRequested {
-		syncService := sync.GetSynchronizationServiceInstance()
-		err = syncService.Synchronize()
+	syncService := sync.GetSynchronizationServiceInstance()
+	syncService.Init(pipedClient)
+	ctx, gracefulCtx, releaseSignals := handleSignals(syncService)
+	if settings.GetSettingsService().RulesTestVideoId != "" {
+		explanation, err := syncService.ExplainRules(ctx, settings.GetSettingsService().RulesTestVideoId)
+		if err != nil {
+			utils.GetLoggingService().FatalFromError(utils.WrapError("failed to evaluate the rules", err))
+		}
+		explanation.Print()
+	} else if settings.GetSettingsService().DaemonRequested {
+		runDaemon(ctx, gracefulCtx, syncService, configuration)
+	} else if settings.GetSettingsService().SynchronizationRequested {
+		if settings.GetSettingsService().RebucketRequested {
+			err = syncService.Rebucket()
+			if err != nil {
+				utils.GetLoggingService().FatalFromError(utils.WrapError("failed to file the videos again", err))
+			}
+		}
+		err = syncService.Synchronize(ctx)
 		if err != nil {
 			utils.GetLoggingService().FatalFromError(utils.WrapError("failed to synchronize", err))
 		}
 	}
+	releaseSignals()
 
 	// ends up the app
 	finalize()
@@ -66,10 +119,17 @@ func main() {
 
 func parseArguments() {
 	// parse the args and let Flag decides if the args are provided
+	flag.Usage = func() {
+		output := flag.CommandLine.Output()
+		_, _ = fmt.Fprintf(output, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		_, _ = fmt.Fprintf(output, "Commands:\n  rules test <video-id>\n    \tAction: explain which rules match a video, and the playlists it would go to\n")
+	}
 	flag.Parse()
 
 	// init the logging service
-	utils.GetLoggingService().InitializeLogger(*logFlag, *debugFlag, finalize)
+	// in daemon mode, the log file keeps track of the runs
+	utils.GetLoggingService().InitializeLogger(*logFlag, *debugFlag, *daemonFlag, finalize)
 
 	// is help needed?
 	if *helpFlag {
@@ -79,7 +139,7 @@ func parseArguments() {
 
 	// is version requested?
 	if *versionFlag {
-		utils.GetLoggingService().Console("v1.5.0")
+		utils.GetLoggingService().Console(version)
 		os.Exit(0)
 	}
 
@@ -96,16 +156,129 @@ func parseArguments() {
 		)
 	}
 
-	// ensure that the sync action is requested
-	if !*syncFlag {
+	// apply the dry-run mode if requested
+	settings.GetSettingsService().DryRun = *dryRunFlag
+
+	// the commands follow the flags
+	rulesTestVideoId := ""
+	if flag.NArg() != 0 {
+		if flag.NArg() != 3 || flag.Arg(0) != "rules" || flag.Arg(1) != "test" {
+			utils.GetLoggingService().FatalFromError(fmt.Errorf("unknown command: '%s'", strings.Join(flag.Args(), " ")))
+		}
+		rulesTestVideoId = flag.Arg(2)
+	}
+
+	// ensure that an action is requested
+	if !*syncFlag && !*daemonFlag && !*rebucketFlag && rulesTestVideoId == "" {
 		flag.Usage()
 		os.Exit(0)
 	}
+	if rulesTestVideoId != "" && (*syncFlag || *daemonFlag || *rebucketFlag) {
+		utils.GetLoggingService().FatalFromError(errors.New("the rules test command can't be used along with another action"))
+	}
+	if *daemonFlag && *dryRunFlag {
+		utils.GetLoggingService().FatalFromError(errors.New("--dry-run can't be used along with --daemon"))
+	}
+	if *daemonFlag && *rebucketFlag {
+		utils.GetLoggingService().FatalFromError(errors.New("--rebucket can't be used along with --daemon"))
+	}
 	settings.GetSettingsService().SynchronizationRequested = true
+	settings.GetSettingsService().DaemonRequested = *daemonFlag
+	settings.GetSettingsService().RebucketRequested = *rebucketFlag
+	settings.GetSettingsService().RulesTestVideoId = rulesTestVideoId
+}
+
+// handleSignals stops the synchronization on SIGINT and SIGTERM.
+//
+// The first signal is graceful: the graceful context is done, and the running synchronization ends once the current
+// channel is indexed. The second signal cancels the returned context, aborting the synchronization immediately.
+func handleSignals(syncService *sync.SynchronizationService) (context.Context, context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gracefulCtx, stop := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		msg := "Stop requested, finishing the current channel (send the signal again to stop immediately)"
+		utils.GetLoggingService().Console(msg)
+		utils.GetLoggingService().Info(msg)
+		stop()
+		syncService.Stop()
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		utils.GetLoggingService().Warn("Stop forced, aborting the synchronization")
+		cancel()
+	}()
+	release := func() {
+		signal.Stop(signals)
+		cancel()
+	}
+	return ctx, gracefulCtx, release
+}
+
+// runDaemon synchronizes the playlists at each tick of the configured schedule, until the graceful context is done.
+func runDaemon(ctx context.Context, gracefulCtx context.Context, syncService *sync.SynchronizationService, configuration *model.Configuration) {
+	// the schedule has already been checked along with the configuration
+	schedule, err := scheduler.ParseSchedule(configuration.Daemon.Interval, configuration.Daemon.Cron)
+	if err != nil {
+		utils.GetLoggingService().FatalFromError(utils.WrapError("invalid daemon schedule", err))
+	}
+	jitter := time.Duration(configuration.Daemon.JitterSeconds) * time.Second
+	utils.GetLoggingService().Console(fmt.Sprintf("Daemon started (pid %d)", os.Getpid()))
+	scheduler.NewScheduler(schedule, jitter, configuration.Daemon.RunAtStartup).Run(gracefulCtx, func() error {
+		return syncService.Synchronize(ctx)
+	})
+	utils.GetLoggingService().Console("Daemon stopped")
+}
+
+// authenticate provides a token to the client, either the one from the configuration, the one persisted by a previous
+// run, or a new one.
+//
+// When the credentials are known, a new token is automatically requested and persisted once the current one is rejected.
+func authenticate(ctx context.Context, pipedClient *pipedApi.Client, configuration *model.Configuration) error {
+	account := configuration.Account
+	if strings.TrimSpace(account.Token) != "" {
+		pipedClient.SetToken(account.Token)
+		return nil
+	}
+
+	tokenRepository := db.GetDatabaseServiceInstance().TokenRepository
+	pipedClient.SetCredentials(account.Username, account.Password)
+	pipedClient.OnTokenChanged(func(token string) {
+		_, err := tokenRepository.Save(tokenDb.AuthToken{
+			Instance: configuration.Instance,
+			Username: account.Username,
+			Token:    token,
+		})
+		if err != nil {
+			utils.GetLoggingService().WarnFromError(utils.WrapError("unable to persist the token", err))
+		}
+	})
+	authToken, err := tokenRepository.GetByAccount(configuration.Instance, account.Username)
+	if err == nil {
+		utils.GetLoggingService().Debug("Reusing the persisted token")
+		pipedClient.SetToken(authToken.Token)
+		return nil
+	}
+	if !errors.Is(err, dbCommon.ErrNotExists) {
+		utils.GetLoggingService().WarnFromError(utils.WrapError("unable to read the persisted token", err))
+	}
+	return pipedClient.Login(ctx, account.Username, account.Password)
 }
 
 func finalize() {
-	err := utils.GetLoggingService().SyncLogger()
+	err := db.GetDatabaseServiceInstance().Close()
+	if err != nil {
+		utils.GetLoggingService().ConsoleWarn(fmt.Errorf("database badly closed\n%w", err).Error())
+	}
+	err = utils.GetLoggingService().SyncLogger()
 	if err != nil {
 		utils.GetLoggingService().ConsoleWarn(fmt.Errorf("logger badly flushed, the log file may be incomplete\n%w", err).Error())
 	}
@@ -2,146 +2,195 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	pipedDto "github.com/frajibe/piped-playfeed/piped/dto"
 	pipedVideoDto "github.com/frajibe/piped-playfeed/piped/dto/video"
 	"github.com/frajibe/piped-playfeed/utils"
-	"io"
 	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 	"time"
 )
 
 // FetchChannel calls the remote Piped instance to return a specific channel.
 //
 // Error is returned if the call failed.
-func FetchChannel(subscription pipedDto.SubscriptionDto, instanceBaseUrl string) (*pipedDto.ChannelDto, error) {
-	response, err := http.Get(instanceBaseUrl + subscription.Url)
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) FetchChannel(ctx context.Context, subscription pipedDto.SubscriptionDto) (*pipedDto.ChannelDto, error) {
 	var channel pipedDto.ChannelDto
-	err = json.Unmarshal(body, &channel)
+	err := client.read(ctx, request{method: http.MethodGet, path: subscription.Url}, &channel)
 	if err != nil {
 		return nil, err
 	}
 	return &channel, nil
 }
 
+// ExtractChannelIdFromUrl returns the id of a channel from its url, like '/channel/UCs6A_0Jm21SIvpdKyg9Gmxw' or
+// 'https://www.youtube.com/channel/UCs6A_0Jm21SIvpdKyg9Gmxw'. A channel id is returned as is.
+func ExtractChannelIdFromUrl(url string) string {
+	if index := strings.LastIndex(url, "/channel/"); index >= 0 {
+		url = url[index+len("/channel/"):]
+	}
+	channelId, _, _ := strings.Cut(url, "?")
+	return strings.TrimSuffix(channelId, "/")
+}
+
+// AmbiguityChecker tells if the upload time of a video, only known from the channel listing to be
+// between earliest and latest, is too imprecise to be used as is.
+type AmbiguityChecker func(earliest time.Time, latest time.Time) bool
+
+// KnownVideoChecker tells if a video has already been indexed, so that its details are not worth fetching.
+type KnownVideoChecker func(videoId string) bool
+
+// UpcomingVideoCollector receives the videos of a listing which are not published yet: the ones scheduled in the future
+// (premieres and livestreams), and the livestreams on air.
+type UpcomingVideoCollector func(relatedStream pipedVideoDto.RelatedStreamDto)
+
 // FetchChannelVideos calls the remote Piped instance to return the videos associated with a specific channel.
 //
+// The pages of the channel are browsed until a video uploaded before since is met.
+// The upload date provided by the listing, computed in the given time zone, is used as long as it is precise enough to compare the video with since
+// and isAmbiguous doesn't reject it (nil accepts it), otherwise the video details are fetched through the worker pool
+// of the client. The details of the videos accepted by isKnown (nil accepts none) are never fetched: they are returned
+// with their listing date, or skipped if the listing doesn't provide any. The videos not published yet are skipped,
+// after being given to onUpcoming (nil ignores them).
+//
 // Error is returned if the call failed.
-func FetchChannelVideos(channel *pipedDto.ChannelDto, startDate time.Time, instanceBaseUrl string) (*[]pipedVideoDto.StreamDto, error) {
+func (client *Client) FetchChannelVideos(ctx context.Context, channel *pipedDto.ChannelDto, since time.Time, location *time.Location, isAmbiguous AmbiguityChecker, isKnown KnownVideoChecker, onUpcoming UpcomingVideoCollector) (*[]pipedVideoDto.StreamDto, error) {
 	var videos []pipedVideoDto.StreamDto
-	requestNextPage := true
-	var wg sync.WaitGroup
-	wg.Add(len(channel.RelatedStreams))
-	var mutex sync.Mutex
-	for _, relatedStream := range channel.RelatedStreams {
-		relatedStream := relatedStream
-		go func() {
-			defer wg.Done()
-			if relatedStream.Views >= 0 { // '= -1' if the video is scheduled in the future
-				video, err := FetchVideo(relatedStream, instanceBaseUrl)
-				if err != nil {
-					msg := fmt.Sprintf("unable to retrieve details for the video '%s'", relatedStream.Url)
-					utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
-				} else {
-					if isVideoAllowed(video, startDate) {
-						mutex.Lock()
-						videos = append(videos, *video)
-						mutex.Unlock()
-					} else {
-						requestNextPage = false
-					}
-				}
-			}
-		}()
-	}
-	wg.Wait()
-
-	if requestNextPage && len(channel.Nextpage) != 0 {
-		paginatedVideos, err := fetchPaginatedVideos(channel.Id, startDate, channel.Nextpage, instanceBaseUrl)
+	relatedStreams := channel.RelatedStreams
+	nextPageUrl := channel.Nextpage
+	for {
+		pageVideos, requestNextPage := client.fetchRelatedVideos(ctx, relatedStreams, since, location, isAmbiguous, isKnown, onUpcoming)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		videos = append(videos, pageVideos...)
+		if !requestNextPage || len(nextPageUrl) == 0 {
+			break
+		}
+		nextPage, err := client.fetchNextPage(ctx, channel.Id, nextPageUrl)
 		if err != nil {
 			return nil, err
 		}
-		videos = append(videos, *paginatedVideos...)
+		relatedStreams = nextPage.RelatedStreams
+		nextPageUrl = nextPage.Nextpage
 	}
 	return &videos, nil
 }
 
-func fetchPaginatedVideos(channelId string, startDate time.Time, nextPageUrl string, instanceBaseUrl string) (*[]pipedVideoDto.StreamDto, error) {
-	// perform the request
-	response, err := http.Get(instanceBaseUrl + "/nextpage/channel/" + channelId + "?nextpage=" + url.QueryEscape(nextPageUrl))
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-
-	// parse the response to obtain the paginated videos
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) fetchNextPage(ctx context.Context, channelId string, nextPageUrl string) (*pipedVideoDto.NextVideosPageDto, error) {
 	var nextPage pipedVideoDto.NextVideosPageDto
-	err = json.Unmarshal(body, &nextPage)
+	err := client.read(ctx, request{method: http.MethodGet, path: "/nextpage/channel/" + channelId + "?nextpage=" + url.QueryEscape(nextPageUrl)}, &nextPage)
 	if err != nil {
 		return nil, err
 	}
+	return &nextPage, nil
+}
 
-	// analyze the content
-	var videos []pipedVideoDto.StreamDto
-	var requestNextPage = true
-	var wg sync.WaitGroup
-	wg.Add(len(nextPage.RelatedStreams))
-	var mutex sync.Mutex
-	for _, relatedStream := range nextPage.RelatedStreams {
-		relatedStream := relatedStream
-		go func() {
-			defer wg.Done()
-			if relatedStream.Views >= 0 { // '= -1' if the video is scheduled in the future
-				video, err := FetchVideo(relatedStream, instanceBaseUrl)
-				if err != nil {
-					msg := fmt.Sprintf("unable to retrieve details for the video '%s'", relatedStream.Url)
-					utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
-				} else {
-					if isVideoAllowed(video, startDate) {
-						mutex.Lock()
-						videos = append(videos, *video)
-						mutex.Unlock()
-					} else {
-						requestNextPage = false
-					}
-				}
+// fetchRelatedVideos resolves a page of videos, and returns the ones uploaded since the given time in the page order.
+//
+// The next page is worth requesting only if none of the videos of the page has been uploaded before since.
+func (client *Client) fetchRelatedVideos(ctx context.Context, relatedStreams []pipedVideoDto.RelatedStreamDto, since time.Time, location *time.Location, isAmbiguous AmbiguityChecker, isKnown KnownVideoChecker, onUpcoming UpcomingVideoCollector) ([]pipedVideoDto.StreamDto, bool) {
+	// each video writes its own slot, so the page order is kept whatever the completion order
+	resolvedVideos := make([]*pipedVideoDto.StreamDto, len(relatedStreams))
+	fromListing := make([]bool, len(relatedStreams))
+	var detailIndexes []int
+	now := time.Now()
+	for index, relatedStream := range relatedStreams {
+		// 'views = -1' if the video is scheduled in the future, 'duration = -1' if the video is on air
+		if relatedStream.Views < 0 || relatedStream.Duration < 0 {
+			if onUpcoming != nil {
+				onUpcoming(relatedStream)
 			}
-		}()
+			continue
+		}
+		known := isKnown != nil && isKnown(ExtractVideoIdFromUrl(relatedStream.Url))
+		if known && relatedStream.Uploaded <= 0 {
+			continue
+		}
+		if known || isListingDateSufficient(relatedStream, since, isAmbiguous, now) {
+			video := streamFromListing(relatedStream, location)
+			resolvedVideos[index] = &video
+			fromListing[index] = true
+		} else {
+			detailIndexes = append(detailIndexes, index)
+		}
 	}
-	wg.Wait()
-
-	if requestNextPage && len(nextPage.Nextpage) != 0 {
-		nextVideos, err := fetchPaginatedVideos(channelId, startDate, nextPage.Nextpage, instanceBaseUrl)
+	client.workerPool.Run(ctx, len(detailIndexes), func(i int) {
+		relatedStream := relatedStreams[detailIndexes[i]]
+		video, err := client.FetchVideo(ctx, relatedStream)
 		if err != nil {
-			return nil, err
+			msg := fmt.Sprintf("unable to retrieve details for the video '%s'", relatedStream.Url)
+			utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
+			return
+		}
+		resolvedVideos[detailIndexes[i]] = video
+	})
+	utils.GetLoggingService().Debug(fmt.Sprintf("%d videos resolved from the listing, %d from their details", len(relatedStreams)-len(detailIndexes), len(detailIndexes)))
+
+	var videos []pipedVideoDto.StreamDto
+	requestNextPage := true
+	for index, video := range resolvedVideos {
+		if video == nil {
+			continue
+		}
+		earliest, latest := uploadedBounds(*video, fromListing[index], now, location)
+		if latest.Before(since) {
+			requestNextPage = false
+		} else if !earliest.After(now) {
+			videos = append(videos, *video)
 		}
-		videos = append(videos, *nextVideos...)
 	}
-	return &videos, nil
+	return videos, requestNextPage
+}
+
+// isListingDateSufficient tells if the upload date provided by the listing can be used instead of the one provided
+// by the video details.
+//
+// The listing date is computed by Piped from a relative text ("3 weeks ago"), so it is only trusted when the whole
+// uncertainty range is on the same side of since and accepted by isAmbiguous.
+func isListingDateSufficient(relatedStream pipedVideoDto.RelatedStreamDto, since time.Time, isAmbiguous AmbiguityChecker, now time.Time) bool {
+	if relatedStream.Uploaded <= 0 {
+		return false
+	}
+	earliest, latest := uploadedRange(relatedStream.Uploaded, now)
+	if earliest.Before(since) && !latest.Before(since) {
+		return false
+	}
+	return isAmbiguous == nil || !isAmbiguous(earliest, latest)
 }
 
-func isVideoAllowed(video *pipedVideoDto.StreamDto, startDate time.Time) bool {
-	videoDate, _ := time.Parse("2006-01-02", video.UploadDate)
-	return !videoDate.Before(startDate) && !videoDate.After(time.Now())
+// uploadedBounds returns the range in which a resolved video has been uploaded.
+//
+// The video details only provide the day of the upload, taken in the given time zone, whereas the listing provides a
+// more or less precise time.
+func uploadedBounds(video pipedVideoDto.StreamDto, fromListing bool, now time.Time, location *time.Location) (time.Time, time.Time) {
+	if fromListing {
+		return uploadedRange(video.Uploaded, now)
+	}
+	day, _ := time.ParseInLocation("2006-01-02", video.UploadDate, location)
+	return day, day.Add(24*time.Hour - time.Millisecond)
+}
+
+// uploadedRange returns the range in which a video has been uploaded, according to a listing date.
+//
+// The precision of the relative text decreases with the age of the video: "5 hours ago", "3 days ago", "2 weeks ago"...
+func uploadedRange(uploaded int64, now time.Time) (time.Time, time.Time) {
+	uploadedTime := time.UnixMilli(uploaded).UTC()
+	age := now.Sub(uploadedTime)
+	var precision time.Duration
+	switch {
+	case age < 24*time.Hour:
+		precision = time.Hour
+	case age < 7*24*time.Hour:
+		precision = 24 * time.Hour
+	case age < 31*24*time.Hour:
+		precision = 7 * 24 * time.Hour
+	case age < 365*24*time.Hour:
+		precision = 31 * 24 * time.Hour
+	default:
+		precision = 366 * 24 * time.Hour
+	}
+	return uploadedTime.Add(-precision), uploadedTime.Add(precision)
 }
@@ -0,0 +1,99 @@
+// Package api provides functions to easily access the Piped Api.
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerPolicy represents when the requests to an instance are paused because it keeps failing.
+//
+// Zero values are replaced by the defaults.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit.
+	FailureThreshold int
+	// Pause is the time during which no request is sent once the circuit is open.
+	Pause time.Duration
+}
+
+const defaultFailureThreshold = 5
+const defaultPause = time.Minute
+
+func (policy CircuitBreakerPolicy) withDefaults() CircuitBreakerPolicy {
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = defaultFailureThreshold
+	}
+	if policy.Pause <= 0 {
+		policy.Pause = defaultPause
+	}
+	return policy
+}
+
+// circuitBreaker pauses the requests to an instance once too many consecutive failures occurred.
+//
+// Once the pause is over, the circuit is half-open and the requests are sent again:
+// a success closes the circuit, a failure immediately reopens it.
+type circuitBreaker struct {
+	policy              CircuitBreakerPolicy
+	baseUrl             string
+	consecutiveFailures int
+	openUntil           time.Time
+	// halfOpen tells if the circuit has been opened and not closed since, by a success
+	halfOpen bool
+	mutex    sync.Mutex
+}
+
+func newCircuitBreaker(policy CircuitBreakerPolicy, baseUrl string) *circuitBreaker {
+	return &circuitBreaker{
+		policy:  policy.withDefaults(),
+		baseUrl: baseUrl,
+	}
+}
+
+// wait blocks while the circuit is open, unless the context is done before.
+func (breaker *circuitBreaker) wait(ctx context.Context) error {
+	breaker.mutex.Lock()
+	remaining := time.Until(breaker.openUntil)
+	breaker.mutex.Unlock()
+	if remaining <= 0 {
+		return nil
+	}
+	return sleep(ctx, remaining)
+}
+
+// isOpen tells if the requests are currently paused.
+func (breaker *circuitBreaker) isOpen() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return time.Now().Before(breaker.openUntil)
+}
+
+// succeeded closes the circuit.
+func (breaker *circuitBreaker) succeeded() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.consecutiveFailures = 0
+	breaker.halfOpen = false
+}
+
+// failed records a failure, and opens the circuit if the threshold is reached or if it is half-open.
+//
+// The failures of the requests sent before the circuit opened don't extend the pause.
+func (breaker *circuitBreaker) failed() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	now := time.Now()
+	if now.Before(breaker.openUntil) {
+		return
+	}
+	breaker.consecutiveFailures++
+	if breaker.halfOpen || breaker.consecutiveFailures >= breaker.policy.FailureThreshold {
+		breaker.openUntil = now.Add(breaker.policy.Pause)
+		breaker.consecutiveFailures = 0
+		breaker.halfOpen = true
+		utils.GetLoggingService().Warn(fmt.Sprintf("'%s' keeps failing, requests paused for %s", breaker.baseUrl, breaker.policy.Pause))
+	}
+}
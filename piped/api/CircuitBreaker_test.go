@@ -0,0 +1,71 @@
+package api
+
+import (
+	"github.com/frajibe/piped-playfeed/utils"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPause = 50 * time.Millisecond
+
+func initializeLogger(t *testing.T) {
+	utils.GetLoggingService().InitializeLogger(filepath.Join(t.TempDir(), "piped-playfeed-log.json"), true, false, func() {})
+}
+
+func newTestCircuitBreaker(t *testing.T) *circuitBreaker {
+	initializeLogger(t)
+	return newCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 3, Pause: testPause}, "http://piped.test")
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	breaker := newTestCircuitBreaker(t)
+	breaker.failed()
+	breaker.failed()
+	breaker.succeeded()
+	breaker.failed()
+	breaker.failed()
+	if breaker.isOpen() {
+		t.Fatalf("circuit opened before the threshold")
+	}
+	breaker.failed()
+	if !breaker.isOpen() {
+		t.Fatalf("circuit not opened at the threshold")
+	}
+	// failure of a request sent before the circuit opened
+	openUntil := breaker.openUntil
+	breaker.failed()
+	if breaker.openUntil != openUntil {
+		t.Errorf("the pause has been extended")
+	}
+	time.Sleep(testPause)
+	if breaker.isOpen() {
+		t.Errorf("circuit still open after the pause")
+	}
+}
+
+func TestCircuitBreakerReopensOnFailureWhenHalfOpen(t *testing.T) {
+	breaker := newTestCircuitBreaker(t)
+	for i := 0; i < 3; i++ {
+		breaker.failed()
+	}
+	time.Sleep(testPause)
+	breaker.failed()
+	if !breaker.isOpen() {
+		t.Fatalf("circuit not reopened by the first failure after the pause")
+	}
+}
+
+func TestCircuitBreakerClosesOnSuccessWhenHalfOpen(t *testing.T) {
+	breaker := newTestCircuitBreaker(t)
+	for i := 0; i < 3; i++ {
+		breaker.failed()
+	}
+	time.Sleep(testPause)
+	breaker.succeeded()
+	breaker.failed()
+	breaker.failed()
+	if breaker.isOpen() {
+		t.Errorf("circuit opened before the threshold once closed")
+	}
+}
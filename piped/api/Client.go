@@ -0,0 +1,312 @@
+// Package api provides functions to easily access the Piped Api.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is the user agent sent to the Piped instance when none is provided.
+const DefaultUserAgent = "piped-playfeed"
+
+// defaultTimeout is applied on the requests which are expected to be quickly answered.
+const defaultTimeout = 10 * time.Second
+
+// defaultLongTimeout is applied on the requests altering the playlists, which may take a while on big playlists.
+const defaultLongTimeout = 180 * time.Second
+
+// ClientOptions represents the optional settings of a Client.
+//
+// Zero values are replaced by the defaults.
+type ClientOptions struct {
+	// HttpClient performs the requests, a dedicated one is created if nil.
+	HttpClient *http.Client
+	// Timeout is applied on the read requests.
+	Timeout time.Duration
+	// LongTimeout is applied on the requests altering the playlists.
+	LongTimeout time.Duration
+	// UserAgent is sent along with every request.
+	UserAgent string
+	// RetryPolicy defines how the failed requests are retried.
+	RetryPolicy RetryPolicy
+	// CircuitBreakerPolicy defines when the requests are paused because the instance keeps failing.
+	CircuitBreakerPolicy CircuitBreakerPolicy
+	// WorkerPool bounds the concurrent video requests, a dedicated one is created if nil.
+	// Sharing a pool between clients applies a global limit.
+	WorkerPool *WorkerPool
+}
+
+// Client represents a client of a specific Piped instance.
+//
+// It owns the connection settings and the token of the authenticated user, so several clients can live side by side.
+type Client struct {
+	baseUrl     string
+	httpClient  *http.Client
+	timeout     time.Duration
+	longTimeout time.Duration
+	userAgent   string
+	retryPolicy RetryPolicy
+	breaker     *circuitBreaker
+	workerPool  *WorkerPool
+	readPool    *InstancePool
+	health      instanceHealth
+	token       string
+	tokenMutex  sync.RWMutex
+	// credentials allow to authenticate again once the token is rejected
+	username       string
+	password       string
+	authMutex      sync.Mutex
+	reauthMutex    sync.Mutex
+	tokenListeners []func(token string)
+}
+
+// NewClient creates a client for the Piped instance located at baseUrl.
+func NewClient(baseUrl string, options ClientOptions) *Client {
+	client := &Client{
+		baseUrl:     strings.TrimRight(baseUrl, "/"),
+		httpClient:  options.HttpClient,
+		timeout:     options.Timeout,
+		longTimeout: options.LongTimeout,
+		userAgent:   options.UserAgent,
+		retryPolicy: options.RetryPolicy.withDefaults(),
+		workerPool:  options.WorkerPool,
+	}
+	client.breaker = newCircuitBreaker(options.CircuitBreakerPolicy, client.baseUrl)
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{}
+	}
+	if client.workerPool == nil {
+		client.workerPool = NewWorkerPool(DefaultWorkerPoolSize)
+	}
+	if client.timeout == 0 {
+		client.timeout = defaultTimeout
+	}
+	if client.longTimeout == 0 {
+		client.longTimeout = defaultLongTimeout
+	}
+	if strings.TrimSpace(client.userAgent) == "" {
+		client.userAgent = DefaultUserAgent
+	}
+	return client
+}
+
+// BaseUrl returns the url of the Piped instance Api.
+func (client *Client) BaseUrl() string {
+	return client.baseUrl
+}
+
+// SetReadPool defines the instances handling the requests which don't require any authentication.
+//
+// The pool may contain the client itself.
+func (client *Client) SetReadPool(readPool *InstancePool) {
+	client.readPool = readPool
+}
+
+// ReadPool returns the instances handling the requests which don't require any authentication, nil if undefined.
+func (client *Client) ReadPool() *InstancePool {
+	return client.readPool
+}
+
+// Token returns the token of the authenticated user, empty if not authenticated yet.
+func (client *Client) Token() string {
+	client.tokenMutex.RLock()
+	defer client.tokenMutex.RUnlock()
+	return client.token
+}
+
+// SetToken defines the token of the authenticated user, used by the calls requiring an authentication.
+func (client *Client) SetToken(token string) {
+	client.tokenMutex.Lock()
+	defer client.tokenMutex.Unlock()
+	client.token = token
+}
+
+// SetCredentials defines the credentials used to authenticate again when the token is rejected by the instance.
+//
+// Without credentials, the rejected requests fail.
+func (client *Client) SetCredentials(username string, password string) {
+	client.authMutex.Lock()
+	defer client.authMutex.Unlock()
+	client.username = username
+	client.password = password
+}
+
+// OnTokenChanged registers a function called with the new token each time the authentication succeeds,
+// typically to persist it.
+func (client *Client) OnTokenChanged(listener func(token string)) {
+	client.authMutex.Lock()
+	defer client.authMutex.Unlock()
+	client.tokenListeners = append(client.tokenListeners, listener)
+}
+
+// reauthenticate logs in again using the credentials, unless another request already replaced the rejected token.
+func (client *Client) reauthenticate(ctx context.Context, rejectedToken string) error {
+	// concurrent rejected requests must not log in several times
+	client.reauthMutex.Lock()
+	defer client.reauthMutex.Unlock()
+	client.authMutex.Lock()
+	username, password := client.username, client.password
+	client.authMutex.Unlock()
+	if client.Token() != rejectedToken {
+		return nil
+	}
+	utils.GetLoggingService().Info(fmt.Sprintf("token rejected by '%s', authenticating again", client.baseUrl))
+	return client.Login(ctx, username, password)
+}
+
+func (client *Client) canReauthenticate() bool {
+	client.authMutex.Lock()
+	defer client.authMutex.Unlock()
+	return client.username != "" && client.password != ""
+}
+
+func (client *Client) notifyTokenChanged(token string) {
+	client.authMutex.Lock()
+	listeners := client.tokenListeners
+	client.authMutex.Unlock()
+	for _, listener := range listeners {
+		listener(token)
+	}
+}
+
+// request describes a call to the Piped instance.
+type request struct {
+	method        string
+	path          string
+	payload       interface{}
+	authenticated bool
+	longRunning   bool
+	// idempotent allows the retry of a request which may have been handled by the instance, implicit for GET.
+	idempotent bool
+}
+
+func (req request) isIdempotent() bool {
+	return req.idempotent || req.method == http.MethodGet
+}
+
+// read performs a request which doesn't require any authentication.
+// The request is handled by the read pool if defined, by the client itself otherwise.
+func (client *Client) read(ctx context.Context, req request, result interface{}) error {
+	if client.readPool == nil {
+		return client.do(ctx, req, result)
+	}
+	return client.readPool.do(ctx, req, result)
+}
+
+// do performs a request and unmarshalls the response body into result, unless result is nil.
+// The request is retried according to the retry policy, and paused while the circuit breaker is open.
+// An authenticated request whose token is rejected is sent again once authenticated again, if possible.
+//
+// Error is returned if the call failed or if the response status is not a success.
+func (client *Client) do(ctx context.Context, req request, result interface{}) error {
+	token := client.Token()
+	err := client.doWithRetries(ctx, req, result)
+	if req.authenticated && isUnauthorized(err) && client.canReauthenticate() {
+		if err := client.reauthenticate(ctx, token); err != nil {
+			return utils.WrapError("unable to authenticate again", err)
+		}
+		return client.doWithRetries(ctx, req, result)
+	}
+	return err
+}
+
+func (client *Client) doWithRetries(ctx context.Context, req request, result interface{}) error {
+	for attempt := 1; ; attempt++ {
+		if err := client.breaker.wait(ctx); err != nil {
+			return err
+		}
+		err := client.try(ctx, req, result)
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(ctx, err, req.isIdempotent()) {
+			return err
+		}
+		if attempt >= client.retryPolicy.MaxAttempts {
+			return utils.WrapError(fmt.Sprintf("giving up after %d attempts", attempt), err)
+		}
+		delay, allowed := client.retryPolicy.delay(attempt, err)
+		if !allowed {
+			return utils.WrapError("the instance requested to retry later than allowed", err)
+		}
+		utils.GetLoggingService().Warn(fmt.Sprintf("%s %s%s failed (attempt %d/%d), retrying in %s: %s", req.method, client.baseUrl, req.path, attempt, client.retryPolicy.MaxAttempts, delay, err))
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// try performs a single attempt of a request, and records its outcome into the health of the instance.
+func (client *Client) try(ctx context.Context, req request, result interface{}) error {
+	err := client.attempt(ctx, req, result)
+	client.health.record(err)
+	if err == nil {
+		client.breaker.succeeded()
+	} else if isRetryable(ctx, err, req.isIdempotent()) {
+		client.breaker.failed()
+	}
+	return err
+}
+
+// attempt performs a single attempt of a request.
+func (client *Client) attempt(ctx context.Context, req request, result interface{}) error {
+	timeout := client.timeout
+	if req.longRunning {
+		timeout = client.longTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// build the request
+	var body io.Reader
+	if req.payload != nil {
+		payload, err := json.Marshal(req.payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(payload)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, client.baseUrl+req.path, body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("user-agent", client.userAgent)
+	if req.payload != nil {
+		httpRequest.Header.Set("content-type", "application/json")
+	}
+	if req.authenticated {
+		httpRequest.Header.Set("Authorization", client.Token())
+	}
+
+	// perform the request
+	response, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return &ResponseError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	// parse the response
+	if result == nil {
+		return nil
+	}
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, result)
+}
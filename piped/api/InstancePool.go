@@ -0,0 +1,118 @@
+// Package api provides functions to easily access the Piped Api.
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// InstancePool spreads the requests which don't require any authentication over several Piped instances.
+//
+// A failing instance is immediately replaced by the next healthy one, the paused instances (see CircuitBreakerPolicy)
+// being skipped as long as another instance is available.
+type InstancePool struct {
+	clients []*Client
+	spread  bool
+	next    uint32
+}
+
+// NewInstancePool creates a pool of instances.
+//
+// The instances are used in the given order, unless spread is true: the requests are then distributed in turn
+// over the instances.
+func NewInstancePool(clients []*Client, spread bool) *InstancePool {
+	return &InstancePool{
+		clients: clients,
+		spread:  spread,
+	}
+}
+
+// Health returns the health of each instance of the pool.
+func (pool *InstancePool) Health() []InstanceHealth {
+	var healths []InstanceHealth
+	for _, client := range pool.clients {
+		healths = append(healths, client.Health())
+	}
+	return healths
+}
+
+// do performs a request on the first healthy instance, and fails over the next ones.
+//
+// The server errors of the idempotent requests are failed over even if not retried on the same instance.
+// Once every instance failed, the request is retried on the first candidate according to its retry policy.
+func (pool *InstancePool) do(ctx context.Context, req request, result interface{}) error {
+	candidates := pool.candidates()
+	for _, candidate := range candidates {
+		if candidate.breaker.isOpen() {
+			continue
+		}
+		err := candidate.try(ctx, req, result)
+		if err == nil {
+			return nil
+		}
+		if !canFailOver(ctx, err, req.isIdempotent()) {
+			// the other instances would answer the same
+			return err
+		}
+	}
+	return candidates[0].do(ctx, req, result)
+}
+
+// candidates returns the instances in the order they must be tried, the paused ones last.
+func (pool *InstancePool) candidates() []*Client {
+	start := 0
+	if pool.spread {
+		start = int(atomic.AddUint32(&pool.next, 1)-1) % len(pool.clients)
+	}
+	var healthy, paused []*Client
+	for i := range pool.clients {
+		client := pool.clients[(start+i)%len(pool.clients)]
+		if client.breaker.isOpen() {
+			paused = append(paused, client)
+		} else {
+			healthy = append(healthy, client)
+		}
+	}
+	return append(healthy, paused...)
+}
+
+// InstanceHealth represents the outcome of the requests sent to an instance.
+type InstanceHealth struct {
+	BaseUrl   string
+	Requests  int
+	Failures  int
+	Paused    bool
+	LastError string
+}
+
+// instanceHealth records the outcome of the requests sent to an instance.
+type instanceHealth struct {
+	requests  int
+	failures  int
+	lastError string
+	mutex     sync.Mutex
+}
+
+func (health *instanceHealth) record(err error) {
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+	health.requests++
+	if err != nil {
+		health.failures++
+		health.lastError = err.Error()
+	}
+}
+
+// Health returns the outcome of the requests sent to the instance of the client.
+func (client *Client) Health() InstanceHealth {
+	client.health.mutex.Lock()
+	defer client.health.mutex.Unlock()
+	return InstanceHealth{
+		BaseUrl:   client.baseUrl,
+		Requests:  client.health.requests,
+		Failures:  client.health.failures,
+		Paused:    client.breaker.isOpen(),
+		LastError: client.health.lastError,
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	pipedVideoDto "github.com/frajibe/piped-playfeed/piped/dto/video"
+	"github.com/frajibe/piped-playfeed/piped/pipedtest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUsername = "user"
+const testPassword = "password"
+
+// newTestInstance returns a fake instance serving the video 'video', along with a client of this instance.
+func newTestInstance(t *testing.T, circuitBreakerPolicy CircuitBreakerPolicy) (*pipedtest.Server, *Client) {
+	server := pipedtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddUser(testUsername, testPassword)
+	server.AddChannel(pipedtest.Channel{
+		Id:     "channel",
+		Name:   "Channel",
+		Videos: []pipedtest.Video{{Id: "video", Uploaded: time.Date(2023, 1, 31, 12, 0, 0, 0, time.UTC), Views: 10}},
+	})
+	client := NewClient(server.URL, ClientOptions{
+		Timeout: 200 * time.Millisecond,
+		RetryPolicy: RetryPolicy{
+			MaxAttempts:  3,
+			InitialDelay: time.Millisecond,
+			MaxDelay:     10 * time.Millisecond,
+		},
+		CircuitBreakerPolicy: circuitBreakerPolicy,
+	})
+	return server, client
+}
+
+func fetchTestVideo(client *Client) error {
+	video, err := client.FetchVideo(context.Background(), pipedVideoDto.RelatedStreamDto{Url: "/watch?v=video"})
+	if err == nil && video.UploadDate != "2023-01-31" {
+		return fmt.Errorf("unexpected upload date '%s'", video.UploadDate)
+	}
+	return err
+}
+
+func TestInstancePoolFailsOver(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault pipedtest.Fault
+	}{
+		{"server error", pipedtest.Fault{Path: "/streams/", Status: http.StatusBadGateway}},
+		{"internal error", pipedtest.Fault{Path: "/streams/", Status: http.StatusInternalServerError}},
+		{"unavailable", pipedtest.Fault{Path: "/streams/", Status: http.StatusServiceUnavailable}},
+		{"timeout", pipedtest.Fault{Path: "/streams/", Latency: 500 * time.Millisecond}},
+	}
+	for _, test := range tests {
+		initializeLogger(t)
+		primary, primaryClient := newTestInstance(t, CircuitBreakerPolicy{FailureThreshold: 100})
+		fallback, fallbackClient := newTestInstance(t, CircuitBreakerPolicy{FailureThreshold: 100})
+		primary.InjectFault(test.fault)
+		primaryClient.SetReadPool(NewInstancePool([]*Client{primaryClient, fallbackClient}, false))
+
+		if err := fetchTestVideo(primaryClient); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		// the fallback serves the request right away, without retrying on the primary
+		if count := primary.RequestCount("/streams/"); count != 1 {
+			t.Errorf("%s: %d requests sent to the primary", test.name, count)
+		}
+		if count := fallback.RequestCount("/streams/"); count != 1 {
+			t.Errorf("%s: %d requests sent to the fallback", test.name, count)
+		}
+		if health := primaryClient.Health(); health.Requests != 1 || health.Failures != 1 {
+			t.Errorf("%s: unexpected health of the primary: %+v", test.name, health)
+		}
+	}
+}
+
+func TestInstancePoolDoesNotFailOverRejectedRequests(t *testing.T) {
+	initializeLogger(t)
+	primary, primaryClient := newTestInstance(t, CircuitBreakerPolicy{})
+	fallback, fallbackClient := newTestInstance(t, CircuitBreakerPolicy{})
+	primary.InjectFault(pipedtest.Fault{Path: "/streams/", Status: http.StatusNotFound})
+	primaryClient.SetReadPool(NewInstancePool([]*Client{primaryClient, fallbackClient}, false))
+
+	if err := fetchTestVideo(primaryClient); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := fallback.RequestCount("/streams/"); count != 0 {
+		t.Errorf("%d requests sent to the fallback", count)
+	}
+}
+
+func TestInstancePoolRetriesOnTheFirstCandidate(t *testing.T) {
+	initializeLogger(t)
+	primary, primaryClient := newTestInstance(t, CircuitBreakerPolicy{FailureThreshold: 100})
+	fallback, fallbackClient := newTestInstance(t, CircuitBreakerPolicy{FailureThreshold: 100})
+	// every instance fails once
+	primary.InjectFault(pipedtest.Fault{Path: "/streams/", Count: 1, Status: http.StatusBadGateway})
+	fallback.InjectFault(pipedtest.Fault{Path: "/streams/", Count: 1, Status: http.StatusBadGateway})
+	primaryClient.SetReadPool(NewInstancePool([]*Client{primaryClient, fallbackClient}, false))
+
+	if err := fetchTestVideo(primaryClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := primary.RequestCount("/streams/"); count != 2 {
+		t.Errorf("%d requests sent to the primary", count)
+	}
+	if count := fallback.RequestCount("/streams/"); count != 1 {
+		t.Errorf("%d requests sent to the fallback", count)
+	}
+}
+
+func TestInstancePoolWaitsWhenAllInstancesArePaused(t *testing.T) {
+	initializeLogger(t)
+	policy := CircuitBreakerPolicy{FailureThreshold: 1, Pause: 50 * time.Millisecond}
+	primary, primaryClient := newTestInstance(t, policy)
+	fallback, fallbackClient := newTestInstance(t, policy)
+	primaryClient.breaker.failed()
+	fallbackClient.breaker.failed()
+	pool := NewInstancePool([]*Client{primaryClient, fallbackClient}, false)
+	primaryClient.SetReadPool(pool)
+	if candidates := pool.candidates(); candidates[0] != primaryClient {
+		t.Fatalf("the paused instances are not kept in order")
+	}
+
+	start := time.Now()
+	if err := fetchTestVideo(primaryClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("the request has not waited for the end of the pause, %s elapsed", elapsed)
+	}
+	if primary.RequestCount("/streams/") != 1 || fallback.RequestCount("/streams/") != 0 {
+		t.Errorf("the request has not been sent to the first candidate")
+	}
+}
+
+func TestInstancePoolSpreadsOnlyTheReads(t *testing.T) {
+	initializeLogger(t)
+	primary, primaryClient := newTestInstance(t, CircuitBreakerPolicy{})
+	secondary, secondaryClient := newTestInstance(t, CircuitBreakerPolicy{})
+	primaryClient.SetReadPool(NewInstancePool([]*Client{primaryClient, secondaryClient}, true))
+	ctx := context.Background()
+	if err := primaryClient.Login(ctx, testUsername, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	// a failed write is retried on the instance of the account, the other instances not knowing the user
+	primary.InjectFault(pipedtest.Fault{Path: "/user/playlists/add", Count: 1, Status: http.StatusServiceUnavailable})
+
+	for i := 0; i < 4; i++ {
+		if err := fetchTestVideo(primaryClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		playlist, err := primaryClient.CreatePlaylist(ctx, "Playlist")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := primaryClient.AddVideosIntoPlaylist(ctx, playlist.PlaylistId, &[]string{"video"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if primary.RequestCount("/streams/") != 2 || secondary.RequestCount("/streams/") != 2 {
+		t.Errorf("the reads are not spread: %d and %d", primary.RequestCount("/streams/"), secondary.RequestCount("/streams/"))
+	}
+	if count := secondary.RequestCount("/user/"); count != 0 {
+		t.Errorf("%d writes sent to the secondary instance", count)
+	}
+	if count := primary.RequestCount("/user/playlists/add"); count != 5 {
+		t.Errorf("%d additions sent to the primary instance", count)
+	}
+	if playlists := primary.Playlists(testUsername); len(playlists) != 4 {
+		t.Errorf("unexpected playlists: %+v", playlists)
+	}
+}
@@ -2,45 +2,18 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
 	pipedPlaylistDto "github.com/frajibe/piped-playfeed/piped/dto/playlist"
 	pipedVideoDto "github.com/frajibe/piped-playfeed/piped/dto/video"
-	"io"
 	"net/http"
-	"time"
 )
 
 // FetchPlaylists calls the remote Piped instance to return the playlists associated with the user token.
 //
 // Error is returned if the call failed.
-func FetchPlaylists(instanceBaseUrl string, userToken string) (*[]pipedPlaylistDto.PlaylistDto, error) {
-	// perform the request
-	req, err := http.NewRequest("GET", instanceBaseUrl+"/user/playlists/", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", userToken)
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-
-	// parse the response to obtain the playlists
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) FetchPlaylists(ctx context.Context) (*[]pipedPlaylistDto.PlaylistDto, error) {
 	var playlists []pipedPlaylistDto.PlaylistDto
-	err = json.Unmarshal(body, &playlists)
+	err := client.do(ctx, request{method: http.MethodGet, path: "/user/playlists/", authenticated: true}, &playlists)
 	if err != nil {
 		return nil, err
 	}
@@ -50,32 +23,9 @@ func FetchPlaylists(instanceBaseUrl string, userToken string) (*[]pipedPlaylistD
 // FetchPlaylistVideos calls the remote Piped instance to return the videos associated with a specific playlist.
 //
 // Error is returned if the call failed.
-func FetchPlaylistVideos(playlistId string, instanceBaseUrl string, userToken string) (*[]pipedVideoDto.RelatedStreamDto, error) {
-	// perform the request
-	req, err := http.NewRequest("GET", instanceBaseUrl+"/playlists/"+playlistId, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", userToken)
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-
-	// parse the response to obtain the videos
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) FetchPlaylistVideos(ctx context.Context, playlistId string) (*[]pipedVideoDto.RelatedStreamDto, error) {
 	var playlistInfo pipedPlaylistDto.PlaylistInfoDto
-	err = json.Unmarshal(body, &playlistInfo)
+	err := client.do(ctx, request{method: http.MethodGet, path: "/playlists/" + playlistId, authenticated: true}, &playlistInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -87,40 +37,12 @@ func FetchPlaylistVideos(playlistId string, instanceBaseUrl string, userToken st
 // The created playlist is returned if the call succeeded.
 //
 // Error is returned if the call failed.
-func CreatePlaylist(name string, instanceBaseUrl string, userToken string) (*pipedPlaylistDto.CreatedPlaylistDto, error) {
-	// perform the request
+func (client *Client) CreatePlaylist(ctx context.Context, name string) (*pipedPlaylistDto.CreatedPlaylistDto, error) {
 	var requestDto = pipedPlaylistDto.CreatePlaylistDto{
 		Name: name,
 	}
-	payload, err := json.Marshal(requestDto)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequest("POST", instanceBaseUrl+"/user/playlists/create", bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", userToken)
-	req.Header.Set("content-type", "application/json")
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-
-	// parse the response to obtain the playlist
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
 	var playlist pipedPlaylistDto.CreatedPlaylistDto
-	err = json.Unmarshal(body, &playlist)
+	err := client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/create", payload: requestDto, authenticated: true}, &playlist)
 	if err != nil {
 		return nil, err
 	}
@@ -130,60 +52,59 @@ func CreatePlaylist(name string, instanceBaseUrl string, userToken string) (*pip
 // AddVideosIntoPlaylist calls the remote Piped instance to insert videos into a specific playlist.
 //
 // Error is returned if the call failed.
-func AddVideosIntoPlaylist(playlistId string, videoIds *[]string, instanceBaseUrl string, userToken string) error {
+func (client *Client) AddVideosIntoPlaylist(ctx context.Context, playlistId string, videoIds *[]string) error {
 	var requestDto = pipedVideoDto.AppendVideosIntoPlaylist{
 		PlaylistId: playlistId,
 		VideoIds:   videoIds,
 	}
-	payload, err := json.Marshal(requestDto)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", instanceBaseUrl+"/user/playlists/add", bytes.NewBuffer(payload))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", userToken)
-	req.Header.Set("content-type", "application/json")
-	client := &http.Client{
-		Timeout: time.Second * 180,
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return fmt.Errorf("invalid response '%s'", response.Status)
+	return client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/add", payload: requestDto, authenticated: true, longRunning: true}, nil)
+}
+
+// RemoveVideoFromPlaylist calls the remote Piped instance to remove the video located at a specific index
+// (starting at 0) of a playlist.
+//
+// The request is only retried when the instance explicitly refused to handle it,
+// since the index may designate another video once a first attempt succeeded.
+//
+// Error is returned if the call failed.
+func (client *Client) RemoveVideoFromPlaylist(ctx context.Context, playlistId string, index int) error {
+	var requestDto = pipedPlaylistDto.RemoveVideoFromPlaylistDto{
+		PlaylistId: playlistId,
+		Index:      index,
 	}
-	return nil
+	return client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/remove", payload: requestDto, authenticated: true}, nil)
 }
 
 // ClearPlaylistVideos calls the remote Piped instance to clear a specific playlist.
 //
 // Error is returned if the call failed.
-func ClearPlaylistVideos(playlistId string, instanceBaseUrl string, userToken string) error {
+func (client *Client) ClearPlaylistVideos(ctx context.Context, playlistId string) error {
 	var requestDto = pipedPlaylistDto.ClearPlaylistDto{
 		PlaylistId: playlistId,
 	}
-	payload, err := json.Marshal(requestDto)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", instanceBaseUrl+"/user/playlists/clear", bytes.NewBuffer(payload))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", userToken)
-	req.Header.Set("content-type", "application/json")
-	client := &http.Client{
-		Timeout: time.Second * 180,
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return err
+	return client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/clear", payload: requestDto, authenticated: true, longRunning: true, idempotent: true}, nil)
+}
+
+// DeletePlaylist calls the remote Piped instance to delete a specific playlist.
+//
+// The request is only retried when the instance explicitly refused to handle it,
+// since the playlist is unknown once a first attempt succeeded.
+//
+// Error is returned if the call failed.
+func (client *Client) DeletePlaylist(ctx context.Context, playlistId string) error {
+	var requestDto = pipedPlaylistDto.DeletePlaylistDto{
+		PlaylistId: playlistId,
 	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return fmt.Errorf("invalid response '%s'", response.Status)
+	return client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/delete", payload: requestDto, authenticated: true}, nil)
+}
+
+// RenamePlaylist calls the remote Piped instance to rename a specific playlist.
+//
+// Error is returned if the call failed.
+func (client *Client) RenamePlaylist(ctx context.Context, playlistId string, newName string) error {
+	var requestDto = pipedPlaylistDto.RenamePlaylistDto{
+		PlaylistId: playlistId,
+		NewName:    newName,
 	}
-	return nil
+	return client.do(ctx, request{method: http.MethodPost, path: "/user/playlists/rename", payload: requestDto, authenticated: true, idempotent: true}, nil)
 }
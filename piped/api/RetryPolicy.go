@@ -0,0 +1,156 @@
+// Package api provides functions to easily access the Piped Api.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy represents how the failed requests are retried.
+//
+// Zero values are replaced by the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request, 1 disables the retries.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry, doubled after each failed attempt.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	// A request is not retried if the instance asks (Retry-After) to wait longer.
+	MaxDelay time.Duration
+}
+
+const defaultMaxAttempts = 4
+const defaultInitialDelay = time.Second
+const defaultMaxDelay = 30 * time.Second
+
+// ResponseError represents a response of the Piped instance which is not a success.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay requested by the instance before trying again, 0 if not provided.
+	RetryAfter time.Duration
+}
+
+func (responseError *ResponseError) Error() string {
+	return fmt.Sprintf("invalid response '%s'", responseError.Status)
+}
+
+// randomSource provides the jitter applied on the delays between two attempts.
+var randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+var randomMutex sync.Mutex
+
+func (policy RetryPolicy) withDefaults() RetryPolicy {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = defaultInitialDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultMaxDelay
+	}
+	if policy.MaxDelay < policy.InitialDelay {
+		policy.MaxDelay = policy.InitialDelay
+	}
+	return policy
+}
+
+// delay returns the time to wait before the next attempt, once the given attempt (starting at 1) has failed.
+//
+// The exponential backoff is randomized between its half and its full value to spread the retries,
+// unless the instance explicitly requested a delay.
+// False is returned if the instance requested a delay greater than the policy maximum.
+func (policy RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var responseError *ResponseError
+	if errors.As(err, &responseError) && responseError.RetryAfter > 0 {
+		if responseError.RetryAfter > policy.MaxDelay {
+			return 0, false
+		}
+		return responseError.RetryAfter, true
+	}
+	backoff := policy.InitialDelay
+	for i := 1; i < attempt && backoff < policy.MaxDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > policy.MaxDelay {
+		backoff = policy.MaxDelay
+	}
+	randomMutex.Lock()
+	jitter := time.Duration(randomSource.Int63n(int64(backoff/2) + 1))
+	randomMutex.Unlock()
+	return backoff/2 + jitter, true
+}
+
+// isRetryable tells if a failed request deserves another attempt.
+//
+// Requests which are not idempotent are only retried when the instance explicitly refused to handle them.
+func isRetryable(ctx context.Context, err error, idempotent bool) bool {
+	if ctx.Err() != nil {
+		// the caller gave up
+		return false
+	}
+	var responseError *ResponseError
+	if errors.As(err, &responseError) {
+		switch responseError.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return idempotent
+		default:
+			return false
+		}
+	}
+	// network failure or timeout of the attempt
+	return idempotent
+}
+
+// canFailOver tells if a failed request deserves an attempt on another instance.
+//
+// Beyond the retryable failures, any server error of an idempotent request is worth another instance:
+// an instance failing to extract a video doesn't mean the others would fail as well.
+func canFailOver(ctx context.Context, err error, idempotent bool) bool {
+	if isRetryable(ctx, err, idempotent) {
+		return true
+	}
+	var responseError *ResponseError
+	return ctx.Err() == nil && idempotent && errors.As(err, &responseError) && responseError.StatusCode >= http.StatusInternalServerError
+}
+
+// isUnauthorized tells if a request failed because the token has been rejected.
+func isUnauthorized(err error) bool {
+	var responseError *ResponseError
+	return errors.As(err, &responseError) &&
+		(responseError.StatusCode == http.StatusUnauthorized || responseError.StatusCode == http.StatusForbidden)
+}
+
+// parseRetryAfter returns the delay of a 'Retry-After' header, expressed either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// sleep waits for the given duration, unless the context is done before.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
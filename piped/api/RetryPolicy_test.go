@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}.withDefaults()
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		// capped
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{50, 2500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			delay, retry := policy.delay(test.attempt, errors.New("network failure"))
+			if !retry {
+				t.Fatalf("attempt %d: retry expected", test.attempt)
+			}
+			if delay < test.min || delay > test.max {
+				t.Fatalf("attempt %d: delay %s out of [%s, %s]", test.attempt, delay, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyDelayHonorsRetryAfter(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}.withDefaults()
+	tests := []struct {
+		retryAfter time.Duration
+		expected   time.Duration
+		retry      bool
+	}{
+		{3 * time.Second, 3 * time.Second, true},
+		{5 * time.Second, 5 * time.Second, true},
+		{6 * time.Second, 0, false},
+	}
+	for _, test := range tests {
+		err := fmt.Errorf("request failed: %w", &ResponseError{StatusCode: http.StatusTooManyRequests, RetryAfter: test.retryAfter})
+		delay, retry := policy.delay(1, err)
+		if delay != test.expected || retry != test.retry {
+			t.Errorf("Retry-After %s: expected (%s, %t), got (%s, %t)", test.retryAfter, test.expected, test.retry, delay, retry)
+		}
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 10 * time.Second, MaxDelay: time.Second}.withDefaults()
+	if policy.MaxAttempts != defaultMaxAttempts || policy.MaxDelay != 10*time.Second {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(90 * time.Second).Format(time.RFC850), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, test := range tests {
+		if actual := parseRetryAfter(test.value, now); actual != test.expected {
+			t.Errorf("'%s': expected %s, got %s", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestCanFailOver(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	responseError := func(statusCode int) error {
+		return fmt.Errorf("request failed: %w", &ResponseError{StatusCode: statusCode})
+	}
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		idempotent bool
+		expected   bool
+	}{
+		{"503", context.Background(), responseError(http.StatusServiceUnavailable), false, true},
+		{"500 idempotent", context.Background(), responseError(http.StatusInternalServerError), true, true},
+		{"500", context.Background(), responseError(http.StatusInternalServerError), false, false},
+		{"502", context.Background(), responseError(http.StatusBadGateway), false, false},
+		{"404 idempotent", context.Background(), responseError(http.StatusNotFound), true, false},
+		{"network idempotent", context.Background(), errors.New("connection reset"), true, true},
+		{"cancelled", cancelled, responseError(http.StatusInternalServerError), true, false},
+	}
+	for _, test := range tests {
+		if actual := canFailOver(test.ctx, test.err, test.idempotent); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	responseError := func(statusCode int) error {
+		return fmt.Errorf("request failed: %w", &ResponseError{StatusCode: statusCode})
+	}
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		idempotent bool
+		expected   bool
+	}{
+		{"429", context.Background(), responseError(http.StatusTooManyRequests), false, true},
+		{"503", context.Background(), responseError(http.StatusServiceUnavailable), false, true},
+		{"502 idempotent", context.Background(), responseError(http.StatusBadGateway), true, true},
+		{"502", context.Background(), responseError(http.StatusBadGateway), false, false},
+		{"504 idempotent", context.Background(), responseError(http.StatusGatewayTimeout), true, true},
+		{"504", context.Background(), responseError(http.StatusGatewayTimeout), false, false},
+		{"500 idempotent", context.Background(), responseError(http.StatusInternalServerError), true, false},
+		{"404 idempotent", context.Background(), responseError(http.StatusNotFound), true, false},
+		{"network idempotent", context.Background(), errors.New("connection reset"), true, true},
+		{"network", context.Background(), errors.New("connection reset"), false, false},
+		{"cancelled", cancelled, responseError(http.StatusTooManyRequests), true, false},
+	}
+	for _, test := range tests {
+		if actual := isRetryable(test.ctx, test.err, test.idempotent); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
@@ -2,41 +2,73 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	pipedVideoDto "github.com/frajibe/piped-playfeed/piped/dto/video"
-	"io"
+	"github.com/frajibe/piped-playfeed/utils"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// shortMaxDuration is the duration in seconds up to which a video known from its details only is considered a short.
+const shortMaxDuration = 60
+
 // FetchVideo calls the remote Piped instance and returns the video corresponding to video metadata.
 //
+// The video is a short if the metadata or the details mark it as such, or if it doesn't last more than a minute: the
+// details don't always tell the shorts apart, unlike the listings.
+//
 // Error is returned if the call failed.
-func FetchVideo(videoMeta pipedVideoDto.RelatedStreamDto, instanceBaseUrl string) (*pipedVideoDto.StreamDto, error) {
-	// perform the request
-	response, err := http.Get(instanceBaseUrl + "/streams/" + ExtractVideoIdFromUrl(videoMeta.Url))
-	if err != nil {
-		return nil, err
-	}
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return nil, fmt.Errorf("invalid response '%s'", response.Status)
-	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) FetchVideo(ctx context.Context, videoMeta pipedVideoDto.RelatedStreamDto) (*pipedVideoDto.StreamDto, error) {
 	var video pipedVideoDto.StreamDto
-	err = json.Unmarshal(body, &video)
+	err := client.read(ctx, request{method: http.MethodGet, path: "/streams/" + ExtractVideoIdFromUrl(videoMeta.Url)}, &video)
 	if err != nil {
 		return nil, err
 	}
 	video.Url = videoMeta.Url
 	video.Uploaded = videoMeta.Uploaded
+	video.IsShort = videoMeta.IsShort || video.IsShort || (video.Duration > 0 && video.Duration <= shortMaxDuration)
+	video.Detailed = true
 	return &video, nil
 }
 
+// FetchVideos calls the remote Piped instance through the worker pool of the client, and returns the videos
+// corresponding to video ids in the same order.
+//
+// The videos whose details can't be retrieved are logged and returned as nil.
+func (client *Client) FetchVideos(ctx context.Context, videoIds []string) []*pipedVideoDto.StreamDto {
+	videos := make([]*pipedVideoDto.StreamDto, len(videoIds))
+	client.workerPool.Run(ctx, len(videoIds), func(i int) {
+		video, err := client.FetchVideo(ctx, pipedVideoDto.RelatedStreamDto{Url: "/watch?v=" + videoIds[i]})
+		if err != nil {
+			msg := fmt.Sprintf("unable to retrieve details for the video '%s'", videoIds[i])
+			utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
+			return
+		}
+		videos[i] = video
+	})
+	return videos
+}
+
+// streamFromListing returns the video corresponding to video metadata, without calling the remote Piped instance.
+//
+// The upload day is computed in the given time zone.
+func streamFromListing(videoMeta pipedVideoDto.RelatedStreamDto, location *time.Location) pipedVideoDto.StreamDto {
+	return pipedVideoDto.StreamDto{
+		Uploaded:     videoMeta.Uploaded,
+		UploadDate:   time.UnixMilli(videoMeta.Uploaded).In(location).Format("2006-01-02"),
+		Url:          videoMeta.Url,
+		Title:        videoMeta.Title,
+		Duration:     videoMeta.Duration,
+		Uploader:     videoMeta.UploaderName,
+		UploaderUrl:  videoMeta.UploaderUrl,
+		ThumbnailUrl: videoMeta.Thumbnail,
+		Views:        videoMeta.Views,
+		IsShort:      videoMeta.IsShort,
+	}
+}
+
 // ExtractVideoIdFromUrl returns the video id corresponding to a video url.
 //
 // Example:
@@ -0,0 +1,57 @@
+// Package api provides functions to easily access the Piped Api.
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkerPoolSize is the number of concurrent video requests used when none is provided.
+const DefaultWorkerPoolSize = 8
+
+// WorkerPool bounds the number of tasks running at the same time.
+//
+// The limit is global: it applies on all the callers sharing the pool, including several clients.
+type WorkerPool struct {
+	slots chan struct{}
+}
+
+// NewWorkerPool creates a pool running at most size tasks at the same time.
+func NewWorkerPool(size int) *WorkerPool {
+	if size <= 0 {
+		size = DefaultWorkerPoolSize
+	}
+	return &WorkerPool{
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Run executes task for each index in [0, count[ and waits for their completion.
+//
+// The tasks which didn't start yet are skipped once the context is done.
+func (pool *WorkerPool) Run(ctx context.Context, count int, task func(index int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case pool.slots <- struct{}{}:
+		}
+		// a slot may have been freed along with the cancellation, select picking either of them
+		if ctx.Err() != nil {
+			<-pool.slots
+			break
+		}
+		wg.Add(1)
+		index := i
+		go func() {
+			defer func() {
+				<-pool.slots
+				wg.Done()
+			}()
+			task(index)
+		}()
+	}
+	wg.Wait()
+}
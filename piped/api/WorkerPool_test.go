@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	pipedDto "github.com/frajibe/piped-playfeed/piped/dto"
+	"github.com/frajibe/piped-playfeed/piped/pipedtest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe records the peak number of tasks running at the same time.
+type concurrencyProbe struct {
+	running int32
+	peak    int32
+	runs    int32
+}
+
+func (probe *concurrencyProbe) task(int) {
+	running := atomic.AddInt32(&probe.running, 1)
+	for {
+		peak := atomic.LoadInt32(&probe.peak)
+		if running <= peak || atomic.CompareAndSwapInt32(&probe.peak, peak, running) {
+			break
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	atomic.AddInt32(&probe.running, -1)
+	atomic.AddInt32(&probe.runs, 1)
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	var probe concurrencyProbe
+	NewWorkerPool(3).Run(context.Background(), 50, probe.task)
+	if probe.runs != 50 {
+		t.Errorf("%d tasks run", probe.runs)
+	}
+	if probe.peak != 3 {
+		t.Errorf("%d tasks run at the same time", probe.peak)
+	}
+}
+
+func TestWorkerPoolLimitIsShared(t *testing.T) {
+	var probe concurrencyProbe
+	pool := NewWorkerPool(4)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(context.Background(), 20, probe.task)
+		}()
+	}
+	wg.Wait()
+	if probe.runs != 100 {
+		t.Errorf("%d tasks run", probe.runs)
+	}
+	if probe.peak > 4 {
+		t.Errorf("%d tasks run at the same time", probe.peak)
+	}
+}
+
+func TestWorkerPoolDefaultSize(t *testing.T) {
+	var probe concurrencyProbe
+	NewWorkerPool(0).Run(context.Background(), 3*DefaultWorkerPoolSize, probe.task)
+	if probe.peak != DefaultWorkerPoolSize {
+		t.Errorf("%d tasks run at the same time", probe.peak)
+	}
+}
+
+func TestWorkerPoolStopsOnCancellation(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		var started []int
+		NewWorkerPool(1).Run(ctx, 10, func(index int) {
+			started = append(started, index)
+			if index == 2 {
+				cancel()
+			}
+		})
+		cancel()
+		if !reflect.DeepEqual(started, []int{0, 1, 2}) {
+			t.Fatalf("unexpected tasks started: %v", started)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var probe concurrencyProbe
+	NewWorkerPool(4).Run(ctx, 10, probe.task)
+	if probe.runs != 0 {
+		t.Errorf("%d tasks run once cancelled", probe.runs)
+	}
+}
+
+// newTestChannel returns a fake instance listing a video a day in January 2023, 5 by page, without their upload date.
+func newTestChannel(t *testing.T) *pipedtest.Server {
+	server := pipedtest.NewServer()
+	t.Cleanup(server.Close)
+	server.PageSize = 5
+	var videos []pipedtest.Video
+	for day := 1; day <= 30; day++ {
+		videos = append(videos, pipedtest.Video{
+			Id:              time.Date(2023, 1, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"),
+			Uploaded:        time.Date(2023, 1, day, 12, 0, 0, 0, time.UTC),
+			Views:           10,
+			HideListingDate: true,
+		})
+	}
+	server.AddChannel(pipedtest.Channel{Id: "channel", Name: "Channel", Videos: videos})
+	return server
+}
+
+func TestFetchChannelVideosStopsPaging(t *testing.T) {
+	initializeLogger(t)
+	since := time.Date(2023, 1, 18, 0, 0, 0, 0, time.UTC)
+	var expected []string
+	for day := 30; day >= 18; day-- {
+		expected = append(expected, time.Date(2023, 1, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"))
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		server := newTestChannel(t)
+		// the details complete in any order
+		server.InjectFault(pipedtest.Fault{Path: "/streams/", Count: 4, Latency: 20 * time.Millisecond})
+		client := NewClient(server.URL, ClientOptions{WorkerPool: NewWorkerPool(4)})
+		ctx := context.Background()
+		channel, err := client.FetchChannel(ctx, pipedDto.SubscriptionDto{Url: "/channel/channel"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		videos, err := client.FetchChannelVideos(ctx, channel, since, time.UTC, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var actual []string
+		for _, video := range *videos {
+			actual = append(actual, ExtractVideoIdFromUrl(video.Url))
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected videos: %v", actual)
+		}
+		// the third page holds the first videos uploaded before since
+		if count := server.RequestCount("/nextpage/"); count != 2 {
+			t.Errorf("%d next pages requested", count)
+		}
+		if count := server.RequestCount("/streams/"); count != 15 {
+			t.Errorf("%d video details requested", count)
+		}
+	}
+}
+
+func TestFetchChannelVideosCancelled(t *testing.T) {
+	initializeLogger(t)
+	server := newTestChannel(t)
+	client := NewClient(server.URL, ClientOptions{WorkerPool: NewWorkerPool(4)})
+	channel, err := client.FetchChannel(context.Background(), pipedDto.SubscriptionDto{Url: "/channel/channel"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.FetchChannelVideos(ctx, channel, time.Time{}, time.UTC, nil, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if count := server.RequestCount("/nextpage/") + server.RequestCount("/streams/"); count != 0 {
+		t.Errorf("%d requests sent once cancelled", count)
+	}
+}
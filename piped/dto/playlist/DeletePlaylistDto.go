@@ -0,0 +1,7 @@
+// Package playlist provides the Dto related to the Piped playlists.
+package playlist
+
+// DeletePlaylistDto represents the request payload needed to delete a playlist using the Piped Api.
+type DeletePlaylistDto struct {
+	PlaylistId string `json:"playlistId"`
+}
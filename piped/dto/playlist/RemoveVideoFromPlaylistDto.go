@@ -0,0 +1,8 @@
+// Package playlist provides the Dto related to the Piped playlists.
+package playlist
+
+// RemoveVideoFromPlaylistDto represents the request payload needed to remove a video from a playlist using the Piped Api.
+type RemoveVideoFromPlaylistDto struct {
+	PlaylistId string `json:"playlistId"`
+	Index      int    `json:"index"`
+}
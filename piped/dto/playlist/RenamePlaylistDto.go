@@ -0,0 +1,8 @@
+// Package playlist provides the Dto related to the Piped playlists.
+package playlist
+
+// RenamePlaylistDto represents the request payload needed to rename a playlist using the Piped Api.
+type RenamePlaylistDto struct {
+	PlaylistId string `json:"playlistId"`
+	NewName    string `json:"newName"`
+}
@@ -6,4 +6,11 @@ type RelatedStreamDto struct {
 	Uploaded int64
 	Url      string
 	Views    int64
+	Title    string
+	// Duration is in seconds.
+	Duration     int64
+	UploaderName string
+	UploaderUrl  string
+	Thumbnail    string
+	IsShort      bool
 }
@@ -6,4 +6,20 @@ type StreamDto struct {
 	Uploaded   int64
 	UploadDate string
 	Url        string
+	Title      string
+	// Duration is in seconds.
+	Duration     int64
+	Uploader     string
+	UploaderUrl  string
+	ThumbnailUrl string
+	Views        int64
+	// IsShort is provided by the listings, and by the details of some instances only.
+	IsShort bool
+	// Category, Livestream and Description are only provided by the video details, empty if the video comes from a
+	// listing.
+	Category    string
+	Livestream  bool
+	Description string
+	// Detailed tells that the video comes from its details, rather than from a listing.
+	Detailed bool `json:"-"`
 }
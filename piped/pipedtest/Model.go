@@ -0,0 +1,53 @@
+// Package pipedtest provides an in-process fake Piped instance, to test the clients of the Piped Api.
+package pipedtest
+
+import "time"
+
+// Channel represents a channel hosted by the fake instance.
+type Channel struct {
+	Id   string
+	Name string
+	// Videos are listed by the channel from the newest to the oldest, whatever their order here.
+	Videos []Video
+}
+
+// Video represents a video hosted by the fake instance.
+type Video struct {
+	Id       string
+	Title    string
+	Uploaded time.Time
+	// HideListingDate removes the upload date from the listings, so that only '/streams' provides it.
+	HideListingDate bool
+	// Upcoming marks a video scheduled in the future (premiere or livestream).
+	Upcoming    bool
+	Duration    int64
+	Views       int64
+	IsShort     bool
+	Livestream  bool
+	Category    string
+	Description string
+}
+
+// Playlist represents a playlist of a user of the fake instance.
+type Playlist struct {
+	Id       string
+	Name     string
+	Owner    string
+	VideoIds []string
+}
+
+// Fault represents a failure injected in the answers of the fake instance.
+type Fault struct {
+	// Path is the prefix of the request paths affected by the fault, like '/streams/'.
+	Path string
+	// Count is the number of requests affected by the fault, 0 for all of them.
+	Count int
+	// Latency delays the answer.
+	Latency time.Duration
+	// Status replaces the answer by an error, unless 0.
+	Status int
+	// RetryAfter is sent along with Status.
+	RetryAfter time.Duration
+	// BrokenJson replaces the body of the answer by an invalid JSON.
+	BrokenJson bool
+}
@@ -0,0 +1,502 @@
+// Package pipedtest provides an in-process fake Piped instance, to test the clients of the Piped Api.
+package pipedtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPageSize is the number of videos listed by each page of a channel.
+const DefaultPageSize = 30
+
+// Server represents a fake Piped instance, implementing the endpoints used by piped-playfeed.
+//
+// The content (users, channels, videos, playlists) is scripted using the dedicated functions, and failures can be
+// injected using InjectFault. All the functions are safe for concurrent use.
+type Server struct {
+	// URL is the base url of the fake instance Api.
+	URL string
+	// PageSize is the number of videos listed by each page of a channel.
+	PageSize int
+
+	httpServer    *httptest.Server
+	mutex         sync.Mutex
+	passwords     map[string]string
+	tokens        map[string]string
+	subscriptions map[string][]string
+	channels      map[string]*Channel
+	videos        map[string]*Video
+	playlists     map[string]*Playlist
+	faults        []*Fault
+	requests      map[string]int
+	nextId        int
+}
+
+// NewServer starts a fake instance, which must be closed once done.
+func NewServer() *Server {
+	server := &Server{
+		PageSize:      DefaultPageSize,
+		passwords:     make(map[string]string),
+		tokens:        make(map[string]string),
+		subscriptions: make(map[string][]string),
+		channels:      make(map[string]*Channel),
+		videos:        make(map[string]*Video),
+		playlists:     make(map[string]*Playlist),
+		requests:      make(map[string]int),
+	}
+	server.httpServer = httptest.NewServer(http.HandlerFunc(server.serve))
+	server.URL = server.httpServer.URL
+	return server
+}
+
+// Close shuts down the fake instance.
+func (server *Server) Close() {
+	server.httpServer.Close()
+}
+
+// AddUser registers an account.
+func (server *Server) AddUser(username string, password string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.passwords[username] = password
+}
+
+// RevokeTokens invalidates all the tokens issued so far.
+func (server *Server) RevokeTokens() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.tokens = make(map[string]string)
+}
+
+// AddChannel registers a channel and its videos, replacing any channel having the same id.
+func (server *Server) AddChannel(channel Channel) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.channels[channel.Id] = &channel
+	for i := range channel.Videos {
+		server.videos[channel.Videos[i].Id] = &channel.Videos[i]
+	}
+}
+
+// AddVideo appends a video to a registered channel.
+func (server *Server) AddVideo(channelId string, video Video) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	channel := server.channels[channelId]
+	channel.Videos = append(channel.Videos, video)
+	for i := range channel.Videos {
+		server.videos[channel.Videos[i].Id] = &channel.Videos[i]
+	}
+}
+
+// UpdateVideo applies a change on a registered video.
+func (server *Server) UpdateVideo(videoId string, update func(video *Video)) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	update(server.videos[videoId])
+}
+
+// RenameChannel changes the name of a registered channel.
+func (server *Server) RenameChannel(channelId string, name string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.channels[channelId].Name = name
+}
+
+// Subscribe subscribes a user to a channel.
+func (server *Server) Subscribe(username string, channelId string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.subscriptions[username] = append(server.subscriptions[username], channelId)
+}
+
+// AddPlaylist creates a playlist for a user, and returns its id.
+func (server *Server) AddPlaylist(username string, name string, videoIds ...string) string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.createPlaylist(username, name, videoIds)
+}
+
+// Playlists returns a copy of the playlists of a user, sorted by name.
+func (server *Server) Playlists(username string) []Playlist {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	var playlists []Playlist
+	for _, playlist := range server.playlists {
+		if playlist.Owner == username {
+			playlistCopy := *playlist
+			playlistCopy.VideoIds = append([]string(nil), playlist.VideoIds...)
+			playlists = append(playlists, playlistCopy)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool { return playlists[i].Name < playlists[j].Name })
+	return playlists
+}
+
+// PlaylistByName returns a copy of the playlist of a user having the given name, nil if none.
+func (server *Server) PlaylistByName(username string, name string) *Playlist {
+	for _, playlist := range server.Playlists(username) {
+		if playlist.Name == name {
+			playlist := playlist
+			return &playlist
+		}
+	}
+	return nil
+}
+
+// RemoveFromPlaylist removes a video from a playlist, like a user would do.
+func (server *Server) RemoveFromPlaylist(playlistId string, videoId string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	playlist := server.playlists[playlistId]
+	for i, id := range playlist.VideoIds {
+		if id == videoId {
+			playlist.VideoIds = append(playlist.VideoIds[:i], playlist.VideoIds[i+1:]...)
+			return
+		}
+	}
+}
+
+// InjectFault registers a failure, applied on the matching requests in the order of registration.
+func (server *Server) InjectFault(fault Fault) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = append(server.faults, &fault)
+}
+
+// RequestCount returns the number of requests received so far whose path starts with pathPrefix.
+func (server *Server) RequestCount(pathPrefix string) int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	count := 0
+	for path, pathCount := range server.requests {
+		if strings.HasPrefix(path, pathPrefix) {
+			count += pathCount
+		}
+	}
+	return count
+}
+
+func (server *Server) createPlaylist(username string, name string, videoIds []string) string {
+	server.nextId++
+	id := fmt.Sprintf("playlist-%d", server.nextId)
+	server.playlists[id] = &Playlist{
+		Id:       id,
+		Name:     name,
+		Owner:    username,
+		VideoIds: append([]string(nil), videoIds...),
+	}
+	return id
+}
+
+// takeFault returns the first fault matching a path, and consumes it.
+func (server *Server) takeFault(path string) *Fault {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.requests[path]++
+	for i, fault := range server.faults {
+		if !strings.HasPrefix(path, fault.Path) {
+			continue
+		}
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				server.faults = append(server.faults[:i], server.faults[i+1:]...)
+			}
+		}
+		faultCopy := *fault
+		return &faultCopy
+	}
+	return nil
+}
+
+func (server *Server) serve(writer http.ResponseWriter, request *http.Request) {
+	fault := server.takeFault(request.URL.Path)
+	if fault != nil {
+		if fault.Latency > 0 {
+			select {
+			case <-time.After(fault.Latency):
+			case <-request.Context().Done():
+				return
+			}
+		}
+		if fault.Status != 0 {
+			if fault.RetryAfter > 0 {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+			}
+			http.Error(writer, http.StatusText(fault.Status), fault.Status)
+			return
+		}
+		if fault.BrokenJson {
+			writer.Header().Set("content-type", "application/json")
+			_, _ = writer.Write([]byte(`{"broken": [`))
+			return
+		}
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	status, response := server.route(request)
+	writer.Header().Set("content-type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(response)
+}
+
+// route dispatches a request to its handler, and returns the status and the body of the answer.
+func (server *Server) route(request *http.Request) (int, interface{}) {
+	path := request.URL.Path
+	switch {
+	case request.Method == http.MethodPost && path == "/login":
+		return server.handleLogin(request)
+	case request.Method == http.MethodGet && path == "/subscriptions":
+		return server.authenticated(request, server.handleSubscriptions)
+	case request.Method == http.MethodGet && strings.TrimSuffix(path, "/") == "/user/playlists":
+		return server.authenticated(request, server.handleUserPlaylists)
+	case request.Method == http.MethodPost && strings.HasPrefix(path, "/user/playlists/"):
+		return server.authenticated(request, func(username string) (int, interface{}) {
+			return server.handlePlaylistUpdate(request, username, strings.TrimPrefix(path, "/user/playlists/"))
+		})
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/playlists/"):
+		return server.handlePlaylist(strings.TrimPrefix(path, "/playlists/"))
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/channel/"):
+		return server.handleChannel(strings.TrimPrefix(path, "/channel/"))
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/nextpage/channel/"):
+		return server.handleNextPage(strings.TrimPrefix(path, "/nextpage/channel/"), request.URL.Query().Get("nextpage"))
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/streams/"):
+		return server.handleStream(strings.TrimPrefix(path, "/streams/"))
+	default:
+		return errorResponse(http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func errorResponse(status int, message string) (int, interface{}) {
+	return status, map[string]string{"error": message}
+}
+
+func (server *Server) authenticated(request *http.Request, handler func(username string) (int, interface{})) (int, interface{}) {
+	username, valid := server.tokens[request.Header.Get("Authorization")]
+	if !valid {
+		return errorResponse(http.StatusUnauthorized, "invalid token")
+	}
+	return handler(username)
+}
+
+func (server *Server) handleLogin(request *http.Request) (int, interface{}) {
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&credentials); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	password, known := server.passwords[credentials.Username]
+	if !known || password != credentials.Password {
+		return errorResponse(http.StatusUnauthorized, "invalid credentials")
+	}
+	server.nextId++
+	token := fmt.Sprintf("token-%d", server.nextId)
+	server.tokens[token] = credentials.Username
+	return http.StatusOK, map[string]string{"token": token}
+}
+
+func (server *Server) handleSubscriptions(username string) (int, interface{}) {
+	subscriptions := []map[string]interface{}{}
+	for _, channelId := range server.subscriptions[username] {
+		if channel, present := server.channels[channelId]; present {
+			subscriptions = append(subscriptions, map[string]interface{}{
+				"url":      "/channel/" + channel.Id,
+				"name":     channel.Name,
+				"verified": false,
+			})
+		}
+	}
+	return http.StatusOK, subscriptions
+}
+
+func (server *Server) handleUserPlaylists(username string) (int, interface{}) {
+	playlists := []map[string]interface{}{}
+	for _, playlist := range server.playlists {
+		if playlist.Owner == username {
+			playlists = append(playlists, map[string]interface{}{
+				"id":     playlist.Id,
+				"name":   playlist.Name,
+				"videos": len(playlist.VideoIds),
+			})
+		}
+	}
+	return http.StatusOK, playlists
+}
+
+func (server *Server) handlePlaylistUpdate(request *http.Request, username string, action string) (int, interface{}) {
+	var payload struct {
+		PlaylistId string   `json:"playlistId"`
+		Name       string   `json:"name"`
+		NewName    string   `json:"newName"`
+		VideoIds   []string `json:"videoIds"`
+		Index      *int     `json:"index"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	if action == "create" {
+		return http.StatusOK, map[string]string{"playlistId": server.createPlaylist(username, payload.Name, nil)}
+	}
+	playlist, present := server.playlists[payload.PlaylistId]
+	if !present || playlist.Owner != username {
+		return errorResponse(http.StatusBadRequest, "unknown playlist")
+	}
+	switch action {
+	case "add":
+		playlist.VideoIds = append(playlist.VideoIds, payload.VideoIds...)
+	case "remove":
+		if payload.Index == nil || *payload.Index < 0 || *payload.Index >= len(playlist.VideoIds) {
+			return errorResponse(http.StatusBadRequest, "invalid index")
+		}
+		index := *payload.Index
+		playlist.VideoIds = append(playlist.VideoIds[:index], playlist.VideoIds[index+1:]...)
+	case "clear":
+		playlist.VideoIds = nil
+	case "rename":
+		playlist.Name = payload.NewName
+	case "delete":
+		delete(server.playlists, payload.PlaylistId)
+	default:
+		return errorResponse(http.StatusNotFound, "unknown endpoint")
+	}
+	return http.StatusOK, map[string]string{"message": "ok"}
+}
+
+func (server *Server) handlePlaylist(playlistId string) (int, interface{}) {
+	playlist, present := server.playlists[playlistId]
+	if !present {
+		return errorResponse(http.StatusNotFound, "unknown playlist")
+	}
+	relatedStreams := []map[string]interface{}{}
+	for _, videoId := range playlist.VideoIds {
+		if video, known := server.videos[videoId]; known {
+			relatedStreams = append(relatedStreams, listingItem(video))
+		} else {
+			relatedStreams = append(relatedStreams, map[string]interface{}{"url": "/watch?v=" + videoId, "uploaded": -1})
+		}
+	}
+	return http.StatusOK, map[string]interface{}{
+		"name":           playlist.Name,
+		"videos":         len(playlist.VideoIds),
+		"relatedStreams": relatedStreams,
+	}
+}
+
+func (server *Server) handleChannel(channelId string) (int, interface{}) {
+	channel, present := server.channels[channelId]
+	if !present {
+		return errorResponse(http.StatusNotFound, "unknown channel")
+	}
+	relatedStreams, nextPage := server.channelPage(channel, 0)
+	return http.StatusOK, map[string]interface{}{
+		"id":             channel.Id,
+		"name":           channel.Name,
+		"nextpage":       nextPage,
+		"relatedStreams": relatedStreams,
+	}
+}
+
+func (server *Server) handleNextPage(channelId string, nextPage string) (int, interface{}) {
+	channel, present := server.channels[channelId]
+	if !present {
+		return errorResponse(http.StatusNotFound, "unknown channel")
+	}
+	offset, err := strconv.Atoi(nextPage)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "invalid nextpage")
+	}
+	relatedStreams, followingPage := server.channelPage(channel, offset)
+	return http.StatusOK, map[string]interface{}{
+		"nextpage":       followingPage,
+		"relatedStreams": relatedStreams,
+	}
+}
+
+// channelPage returns the videos of a channel listed from offset, and the token of the next page (null if none).
+func (server *Server) channelPage(channel *Channel, offset int) ([]map[string]interface{}, interface{}) {
+	videos := make([]*Video, len(channel.Videos))
+	for i := range channel.Videos {
+		videos[i] = &channel.Videos[i]
+	}
+	sort.SliceStable(videos, func(i, j int) bool { return videos[i].Uploaded.After(videos[j].Uploaded) })
+	relatedStreams := []map[string]interface{}{}
+	end := offset + server.PageSize
+	for i := offset; i < end && i < len(videos); i++ {
+		relatedStreams = append(relatedStreams, listingItem(videos[i]))
+	}
+	if end >= len(videos) {
+		return relatedStreams, nil
+	}
+	return relatedStreams, strconv.Itoa(end)
+}
+
+func (server *Server) handleStream(videoId string) (int, interface{}) {
+	video, present := server.videos[videoId]
+	if !present {
+		return errorResponse(http.StatusInternalServerError, "video unavailable")
+	}
+	views := video.Views
+	if video.Upcoming {
+		views = -1
+	}
+	uploaderId := ""
+	for _, channel := range server.channels {
+		for i := range channel.Videos {
+			if channel.Videos[i].Id == videoId {
+				uploaderId = channel.Id
+			}
+		}
+	}
+	return http.StatusOK, map[string]interface{}{
+		"title":        video.Title,
+		"description":  video.Description,
+		"uploadDate":   video.Uploaded.UTC().Format("2006-01-02"),
+		"uploader":     server.channelName(uploaderId),
+		"uploaderUrl":  "/channel/" + uploaderId,
+		"duration":     video.Duration,
+		"views":        views,
+		"category":     video.Category,
+		"livestream":   video.Livestream,
+		"thumbnailUrl": "https://example.org/" + video.Id + ".jpg",
+	}
+}
+
+func (server *Server) channelName(channelId string) string {
+	if channel, present := server.channels[channelId]; present {
+		return channel.Name
+	}
+	return ""
+}
+
+// listingItem returns the short description of a video, as provided by the channels and the playlists.
+func listingItem(video *Video) map[string]interface{} {
+	uploaded := video.Uploaded.UnixMilli()
+	if video.HideListingDate {
+		uploaded = -1
+	}
+	views := video.Views
+	if video.Upcoming {
+		views = -1
+	}
+	return map[string]interface{}{
+		"url":       "/watch?v=" + video.Id,
+		"type":      "stream",
+		"title":     video.Title,
+		"uploaded":  uploaded,
+		"views":     views,
+		"duration":  video.Duration,
+		"isShort":   video.IsShort,
+		"thumbnail": "https://example.org/" + video.Id + ".jpg",
+	}
+}
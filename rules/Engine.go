@@ -0,0 +1,168 @@
+// Package rules provides the routing rules, sending the videos to playlists according to their properties.
+package rules
+
+import (
+	"fmt"
+	"github.com/frajibe/piped-playfeed/config/model"
+	pipedApi "github.com/frajibe/piped-playfeed/piped/api"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// weekdays lists the day names of the rules, by time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Video represents the properties of a video the rules are evaluated against.
+type Video struct {
+	ChannelId string
+	Title     string
+	// Duration is in seconds.
+	Duration int64
+	// Category is empty if unknown.
+	Category string
+	// Weekday is the day of the upload.
+	Weekday time.Weekday
+}
+
+// Evaluation represents the outcome of a rule for a video.
+type Evaluation struct {
+	Rule    model.Rule
+	Matched bool
+	// Reason tells why the rule doesn't match, empty if it matches.
+	Reason string
+}
+
+// Engine evaluates the rules of the configuration, in order.
+type Engine struct {
+	rules []compiledRule
+	// fanOut tells that a video goes to all the matching rules rather than the first one
+	fanOut bool
+}
+
+type compiledRule struct {
+	rule       model.Rule
+	channelIds map[string]bool
+	title      *regexp.Regexp
+	categories map[string]bool
+	weekdays   map[time.Weekday]bool
+}
+
+// NewEngine returns an engine evaluating the given rules, according to the mode among 'first' and 'all'.
+func NewEngine(rules []model.Rule, mode string) (*Engine, error) {
+	engine := &Engine{
+		fanOut: strings.EqualFold(mode, model.RulesModeAll),
+	}
+	for _, rule := range rules {
+		compiled := compiledRule{
+			rule:       rule,
+			channelIds: make(map[string]bool),
+			categories: make(map[string]bool),
+			weekdays:   make(map[time.Weekday]bool),
+		}
+		for _, channel := range rule.Channels {
+			compiled.channelIds[pipedApi.ExtractChannelIdFromUrl(channel)] = true
+		}
+		if rule.Title != "" {
+			title, err := regexp.Compile(rule.Title)
+			if err != nil {
+				return nil, fmt.Errorf("invalid title of the rule '%s': %w", rule.Name, err)
+			}
+			compiled.title = title
+		}
+		if rule.MaxDuration != 0 && rule.MaxDuration < rule.MinDuration {
+			return nil, fmt.Errorf("the maximum duration of the rule '%s' is lower than its minimum duration", rule.Name)
+		}
+		for _, category := range rule.Categories {
+			compiled.categories[strings.ToLower(category)] = true
+		}
+		for _, weekday := range rule.Weekdays {
+			day, present := weekdays[strings.ToLower(weekday)]
+			if !present {
+				return nil, fmt.Errorf("invalid weekday of the rule '%s': '%s'", rule.Name, weekday)
+			}
+			compiled.weekdays[day] = true
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+// UsesCategories tells if a rule matches the category of the videos, which is only known from the video details.
+func (engine *Engine) UsesCategories() bool {
+	for _, compiled := range engine.rules {
+		if len(compiled.categories) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the evaluations of the rules for a video, up to the rule deciding its fate.
+//
+// In the 'first' mode, the evaluation stops at the first matching rule. In the 'all' mode, it goes on until an
+// 'ignore' rule matches.
+func (engine *Engine) Evaluate(video Video) []Evaluation {
+	var evaluations []Evaluation
+	for _, compiled := range engine.rules {
+		reason := compiled.mismatch(video)
+		evaluations = append(evaluations, Evaluation{
+			Rule:    compiled.rule,
+			Matched: reason == "",
+			Reason:  reason,
+		})
+		if reason == "" && (!engine.fanOut || strings.EqualFold(compiled.rule.Action, model.RuleActionIgnore)) {
+			break
+		}
+	}
+	return evaluations
+}
+
+// Route returns the rules whose playlists receive a video, and whether the video is ignored.
+//
+// No rule and not ignored means that the video is left to the default playlists. An 'ignore' rule doesn't take back
+// the video from the rules matched before it.
+func (engine *Engine) Route(video Video) ([]model.Rule, bool) {
+	var matchedRules []model.Rule
+	for _, evaluation := range engine.Evaluate(video) {
+		if !evaluation.Matched {
+			continue
+		}
+		if strings.EqualFold(evaluation.Rule.Action, model.RuleActionIgnore) {
+			return matchedRules, len(matchedRules) == 0
+		}
+		matchedRules = append(matchedRules, evaluation.Rule)
+	}
+	return matchedRules, false
+}
+
+// mismatch returns the reason why the rule doesn't match a video, empty if it matches.
+func (compiled compiledRule) mismatch(video Video) string {
+	if len(compiled.channelIds) != 0 && !compiled.channelIds[video.ChannelId] {
+		return fmt.Sprintf("the channel '%s' is not listed", video.ChannelId)
+	}
+	if compiled.title != nil && !compiled.title.MatchString(video.Title) {
+		return fmt.Sprintf("the title '%s' doesn't match '%s'", video.Title, compiled.title)
+	}
+	if video.Duration < compiled.rule.MinDuration {
+		return fmt.Sprintf("the duration %ds is shorter than %ds", video.Duration, compiled.rule.MinDuration)
+	}
+	if compiled.rule.MaxDuration != 0 && video.Duration > compiled.rule.MaxDuration {
+		return fmt.Sprintf("the duration %ds is longer than %ds", video.Duration, compiled.rule.MaxDuration)
+	}
+	if len(compiled.categories) != 0 && !compiled.categories[strings.ToLower(video.Category)] {
+		return fmt.Sprintf("the category '%s' is not listed", video.Category)
+	}
+	if len(compiled.weekdays) != 0 && !compiled.weekdays[video.Weekday] {
+		return fmt.Sprintf("the upload day %s is not listed", video.Weekday)
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+// Package scheduler provides the periodic execution of the synchronization.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule represents when the runs occur.
+type Schedule interface {
+	// Next returns the first run time strictly after the given time, or the zero time if there is none.
+	Next(after time.Time) time.Time
+}
+
+// IntervalSchedule triggers a run at a fixed interval.
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+func (schedule IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(schedule.Interval)
+}
+
+// CronSchedule triggers a run according to a standard cron expression, evaluated in the local time zone.
+type CronSchedule struct {
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+	// anyDayOfMonth and anyDayOfWeek follow the cron rule: when both day fields are restricted, matching one is enough
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+// maxLookAhead bounds the search of the next run, for the expressions which never match (like '0 0 30 2 *').
+const maxLookAhead = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a cron expression made of 5 fields (minute, hour, day of month, month, day of week).
+//
+// Each field accepts '*', values, ranges ('1-5'), steps ('*/15', '0-30/10') and lists of them ('1,15').
+// The aliases '@hourly', '@daily', '@weekly', '@monthly' and '@yearly' are supported too.
+func ParseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if alias, ok := cronAliases[expression]; ok {
+		expression = alias
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': 5 fields expected, got %d", expression, len(fields))
+	}
+	var schedule CronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute in cron expression '%s': %w", expression, err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour in cron expression '%s': %w", expression, err)
+	}
+	if schedule.daysOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day of month in cron expression '%s': %w", expression, err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month in cron expression '%s': %w", expression, err)
+	}
+	// 7 is an alias of Sunday
+	if schedule.daysOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day of week in cron expression '%s': %w", expression, err)
+	}
+	schedule.daysOfWeek[0] = schedule.daysOfWeek[0] || schedule.daysOfWeek[7]
+	schedule.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+	return &schedule, nil
+}
+
+func parseCronField(field string, min int, max int) ([]bool, error) {
+	values := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+		start, end := min, max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(startPart, min, max); err != nil {
+				return nil, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseCronValue(endPart, min, max); err != nil {
+					return nil, err
+				}
+				if end < start {
+					return nil, fmt.Errorf("invalid range '%s'", rangePart)
+				}
+			} else if hasStep {
+				// '5/15' means from 5 to the maximum
+				end = max
+			}
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCronValue(value string, min int, max int) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", value)
+	}
+	if parsed < min || parsed > max {
+		return 0, fmt.Errorf("value '%d' out of range [%d-%d]", parsed, min, max)
+	}
+	return parsed, nil
+}
+
+// Next walks the wall-clock times, so that DST changes are handled like cron does:
+// a wall-clock time repeated when the clocks go back triggers once,
+// and a wall-clock time skipped when the clocks go forward triggers shifted by the length of the gap.
+func (schedule *CronSchedule) Next(after time.Time) time.Time {
+	location := after.Location()
+	wall := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := wall.Add(maxLookAhead)
+	for wall.Before(limit) {
+		year, month, day := wall.Date()
+		if !schedule.months[month] {
+			wall = time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.matchesDay(wall) {
+			wall = time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.hours[wall.Hour()] {
+			wall = time.Date(year, month, day, wall.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.minutes[wall.Minute()] {
+			wall = wall.Add(time.Minute)
+			continue
+		}
+		// time.Date shifts a time in a DST gap forward, possibly onto a time already run
+		if next := time.Date(year, month, day, wall.Hour(), wall.Minute(), 0, 0, location); next.After(after) {
+			return next
+		}
+		wall = wall.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+func (schedule *CronSchedule) matchesDay(date time.Time) bool {
+	dayOfMonth := schedule.daysOfMonth[date.Day()]
+	dayOfWeek := schedule.daysOfWeek[date.Weekday()]
+	switch {
+	case schedule.anyDayOfMonth && schedule.anyDayOfWeek:
+		return true
+	case schedule.anyDayOfMonth:
+		return dayOfWeek
+	case schedule.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+// ParseSchedule returns the schedule defined either by an interval (like '6h' or '90m') or by a cron expression.
+func ParseSchedule(interval string, cron string) (Schedule, error) {
+	interval = strings.TrimSpace(interval)
+	cron = strings.TrimSpace(cron)
+	if (interval == "") == (cron == "") {
+		return nil, errors.New("either an interval or a cron expression must be defined")
+	}
+	if cron != "" {
+		schedule, err := ParseCron(cron)
+		if err != nil {
+			return nil, err
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("the cron expression '%s' never triggers", cron)
+		}
+		return schedule, nil
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval '%s': %w", interval, err)
+	}
+	if duration < time.Minute {
+		return nil, fmt.Errorf("invalid interval '%s': at least 1 minute expected", interval)
+	}
+	return IntervalSchedule{Interval: duration}, nil
+}
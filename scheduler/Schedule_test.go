@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		expression string
+		after      time.Time
+		expected   time.Time
+	}{
+		// steps, ranges and lists
+		{"*/15 * * * *", date(2023, 1, 2, 10, 7), date(2023, 1, 2, 10, 15)},
+		{"*/15 * * * *", date(2023, 1, 2, 10, 45), date(2023, 1, 2, 11, 0)},
+		{"*/15 * * * *", date(2023, 1, 2, 10, 14).Add(59 * time.Second), date(2023, 1, 2, 10, 15)},
+		{"0-30/10 * * * *", date(2023, 1, 2, 10, 15), date(2023, 1, 2, 10, 20)},
+		{"0-30/10 * * * *", date(2023, 1, 2, 10, 31), date(2023, 1, 2, 11, 0)},
+		{"5/15 * * * *", date(2023, 1, 2, 10, 51), date(2023, 1, 2, 11, 5)},
+		{"0 1,15 * * *", date(2023, 1, 2, 2, 0), date(2023, 1, 2, 15, 0)},
+		{"0 9-17 * * *", date(2023, 1, 2, 17, 30), date(2023, 1, 3, 9, 0)},
+		{"0 * * * *", date(2023, 1, 2, 10, 0), date(2023, 1, 2, 11, 0)},
+		// 2023-01-02 is a Monday, and 7 is an alias of Sunday
+		{"0 0 * * 7", date(2023, 1, 2, 0, 0), date(2023, 1, 8, 0, 0)},
+		{"@weekly", date(2023, 1, 2, 0, 0), date(2023, 1, 8, 0, 0)},
+		{"@monthly", date(2023, 1, 15, 0, 0), date(2023, 2, 1, 0, 0)},
+		// day of month and day of week: one of them is enough when both are restricted
+		{"0 0 13 * 5", date(2023, 1, 1, 0, 0), date(2023, 1, 6, 0, 0)},
+		{"0 0 13 * 5", date(2023, 1, 6, 0, 0), date(2023, 1, 13, 0, 0)},
+		{"0 0 13 * 5", date(2023, 1, 13, 0, 0), date(2023, 1, 20, 0, 0)},
+		{"0 0 13 * 1-3", date(2023, 1, 11, 0, 0), date(2023, 1, 13, 0, 0)},
+		{"0 0 13 * *", date(2023, 1, 1, 0, 0), date(2023, 1, 13, 0, 0)},
+		{"0 0 * * 5", date(2023, 1, 13, 0, 0), date(2023, 1, 20, 0, 0)},
+		{"0 0 */10 * 5", date(2023, 1, 1, 0, 0), date(2023, 1, 6, 0, 0)},
+		// month and year rollover
+		{"0 0 31 * *", date(2023, 1, 31, 0, 0), date(2023, 3, 31, 0, 0)},
+		{"59 23 * * *", date(2023, 12, 31, 23, 59), date(2024, 1, 1, 23, 59)},
+		{"@yearly", date(2023, 6, 15, 12, 0), date(2024, 1, 1, 0, 0)},
+		{"0 0 29 2 *", date(2023, 3, 1, 0, 0), date(2024, 2, 29, 0, 0)},
+		{"0 0 * 2 *", date(2023, 2, 28, 0, 0), date(2024, 2, 1, 0, 0)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Errorf("'%s': unexpected error: %v", test.expression, err)
+			continue
+		}
+		if actual := schedule.Next(test.after); !actual.Equal(test.expected) {
+			t.Errorf("'%s' after %s: expected %s, got %s", test.expression, test.after, test.expected, actual)
+		}
+	}
+}
+
+func TestCronScheduleNextAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	inParis := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2023, month, day, hour, minute, 0, 0, paris)
+	}
+	// the clocks go forward from 02:00 to 03:00 on 2023-03-26, and back from 03:00 to 02:00 on 2023-10-29
+	forward := inParis(3, 26, 2, 0)
+	back := inParis(10, 29, 2, 0).Add(-time.Hour)
+	tests := []struct {
+		name       string
+		expression string
+		after      time.Time
+		expected   []time.Time
+	}{
+		{"skipped time shifted", "30 2 * * *", inParis(3, 25, 12, 0),
+			[]time.Time{inParis(3, 26, 3, 30), inParis(3, 27, 2, 30)}},
+		{"skipped hour", "0 * * * *", inParis(3, 26, 0, 30),
+			[]time.Time{inParis(3, 26, 1, 0), inParis(3, 26, 3, 0), inParis(3, 26, 4, 0)}},
+		{"time after the gap", "30 3 * * *", forward.Add(-time.Minute),
+			[]time.Time{inParis(3, 26, 3, 30), inParis(3, 27, 3, 30)}},
+		{"repeated time run once", "30 2 * * *", inParis(10, 28, 12, 0),
+			[]time.Time{inParis(10, 29, 2, 30), inParis(10, 30, 2, 30)}},
+		{"repeated time already passed", "30 2 * * *", back.Add(40 * time.Minute),
+			[]time.Time{inParis(10, 30, 2, 30)}},
+		{"repeated time from the first occurrence", "30 2 * * *", back.Add(10 * time.Minute),
+			[]time.Time{inParis(10, 29, 2, 30), inParis(10, 30, 2, 30)}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		after := test.after
+		for _, expected := range test.expected {
+			actual := schedule.Next(after)
+			if !actual.Equal(expected) {
+				t.Errorf("%s: after %s, expected %s, got %s", test.name, after, expected, actual)
+				break
+			}
+			after = actual
+		}
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+	}{
+		{"", "5 fields expected, got 0"},
+		{"* * * *", "5 fields expected, got 4"},
+		{"* * * * * *", "5 fields expected, got 6"},
+		{"@often", "5 fields expected, got 1"},
+		{"60 * * * *", "invalid minute"},
+		{"* 24 * * *", "invalid hour"},
+		{"* * 0 * *", "invalid day of month"},
+		{"* * 32 * *", "invalid day of month"},
+		{"* * * 13 *", "invalid month"},
+		{"* * * * 8", "invalid day of week"},
+		{"*/0 * * * *", "invalid step '0'"},
+		{"*/x * * * *", "invalid step 'x'"},
+		{"30-10 * * * *", "invalid range '30-10'"},
+		{"a * * * *", "invalid value 'a'"},
+		{"1-b * * * *", "invalid value 'b'"},
+		{"1,,2 * * * *", "invalid value ''"},
+		{"-1 * * * *", "invalid value ''"},
+	}
+	for _, test := range tests {
+		_, err := ParseCron(test.expression)
+		if err == nil {
+			t.Errorf("'%s': error expected", test.expression)
+		} else if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("'%s': expected an error containing \"%s\", got \"%v\"", test.expression, test.message, err)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		interval string
+		cron     string
+		message  string
+	}{
+		{"", "", "either an interval or a cron expression must be defined"},
+		{"1h", "0 * * * *", "either an interval or a cron expression must be defined"},
+		{"1 hour", "", "invalid interval '1 hour'"},
+		{"30s", "", "at least 1 minute expected"},
+		{"", "0 0 30 2 *", "never triggers"},
+		{"", "0 0 * * 9", "invalid day of week"},
+		{"90m", "", ""},
+		{" ", "@daily", ""},
+	}
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.interval, test.cron)
+		switch {
+		case test.message == "" && err != nil:
+			t.Errorf("'%s'/'%s': unexpected error: %v", test.interval, test.cron, err)
+		case test.message == "" && schedule == nil:
+			t.Errorf("'%s'/'%s': schedule expected", test.interval, test.cron)
+		case test.message != "" && (err == nil || !strings.Contains(err.Error(), test.message)):
+			t.Errorf("'%s'/'%s': expected an error containing \"%s\", got \"%v\"", test.interval, test.cron, test.message, err)
+		}
+	}
+	if schedule, _ := ParseSchedule("90m", ""); schedule.Next(date(2023, 1, 2, 10, 0)) != date(2023, 1, 2, 11, 30) {
+		t.Errorf("unexpected interval schedule: %+v", schedule)
+	}
+}
+
+func TestCronScheduleNeverMatching(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := schedule.Next(date(2023, 1, 1, 0, 0)); !next.IsZero() {
+		t.Errorf("no run expected, got %s", next)
+	}
+}
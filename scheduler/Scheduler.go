@@ -0,0 +1,98 @@
+// Package scheduler provides the periodic execution of the synchronization.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	"math/rand"
+	"time"
+)
+
+// Scheduler runs a task according to a schedule, until its context is done.
+//
+// The runs never overlap: the ticks occurring while a run is still going are skipped.
+type Scheduler struct {
+	schedule Schedule
+	// jitter is the maximum random delay added to each tick, so that several users don't hit the instance at once
+	jitter       time.Duration
+	runAtStartup bool
+	random       *rand.Rand
+}
+
+func NewScheduler(schedule Schedule, jitter time.Duration, runAtStartup bool) *Scheduler {
+	return &Scheduler{
+		schedule:     schedule,
+		jitter:       jitter,
+		runAtStartup: runAtStartup,
+		random:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run blocks until the context is done, running the task at each tick.
+//
+// A failed run is logged, the next one being scheduled as usual.
+// The context is only checked between two runs: the task is responsible for stopping early if needed.
+func (scheduler *Scheduler) Run(ctx context.Context, task func() error) {
+	if scheduler.runAtStartup {
+		scheduler.runTask(task)
+	}
+	for {
+		tick := scheduler.schedule.Next(time.Now())
+		if tick.IsZero() {
+			utils.GetLoggingService().Warn("the schedule doesn't trigger anymore, stopping")
+			return
+		}
+		runTime := tick.Add(scheduler.randomJitter())
+		msg := fmt.Sprintf("Next synchronization at %s", runTime.Format(time.RFC3339))
+		utils.GetLoggingService().Info(msg)
+		utils.GetLoggingService().Console(msg)
+
+		timer := time.NewTimer(time.Until(runTime))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		scheduler.runTask(task)
+		if ctx.Err() != nil {
+			return
+		}
+		if skipped := scheduler.countTicks(runTime, time.Now()); skipped != 0 {
+			msg := fmt.Sprintf("The synchronization lasted longer than the schedule period, %d run(s) skipped", skipped)
+			utils.GetLoggingService().Warn(msg)
+			utils.GetLoggingService().ConsoleWarn(msg)
+		}
+	}
+}
+
+func (scheduler *Scheduler) runTask(task func() error) {
+	start := time.Now()
+	utils.GetLoggingService().Info("Synchronization started")
+	err := task()
+	if err != nil {
+		msg := "synchronization failed, waiting for the next run"
+		utils.GetLoggingService().ConsoleWarn(fmt.Sprintf("%s\n%s", msg, err.Error()))
+		utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
+		return
+	}
+	utils.GetLoggingService().Info(fmt.Sprintf("Synchronization done in %s", time.Since(start).Round(time.Second)))
+}
+
+// countTicks returns the number of ticks between two times, bounds excluded.
+func (scheduler *Scheduler) countTicks(from time.Time, to time.Time) int {
+	count := 0
+	for tick := scheduler.schedule.Next(from); !tick.IsZero() && tick.Before(to); tick = scheduler.schedule.Next(tick) {
+		count++
+	}
+	return count
+}
+
+func (scheduler *Scheduler) randomJitter() time.Duration {
+	if scheduler.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(scheduler.random.Int63n(int64(scheduler.jitter) + 1))
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/frajibe/piped-playfeed/utils"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// scheduleFunc adapts a function to the Schedule interface.
+type scheduleFunc func(after time.Time) time.Time
+
+func (schedule scheduleFunc) Next(after time.Time) time.Time {
+	return schedule(after)
+}
+
+func initializeLogger(t *testing.T) {
+	utils.GetLoggingService().InitializeLogger(filepath.Join(t.TempDir(), "piped-playfeed-log.json"), true, false, func() {})
+}
+
+func TestCountTicks(t *testing.T) {
+	everyQuarter, err := ParseCron("*/15 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	never, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     time.Time
+		to       time.Time
+		expected int
+	}{
+		{"short run", IntervalSchedule{Interval: time.Hour}, date(2023, 1, 2, 0, 0), date(2023, 1, 2, 0, 30), 0},
+		{"next tick excluded", IntervalSchedule{Interval: time.Hour}, date(2023, 1, 2, 0, 0), date(2023, 1, 2, 1, 0), 0},
+		{"next tick just missed", IntervalSchedule{Interval: time.Hour}, date(2023, 1, 2, 0, 0), date(2023, 1, 2, 1, 0).Add(time.Second), 1},
+		{"several ticks missed", IntervalSchedule{Interval: time.Hour}, date(2023, 1, 2, 0, 0), date(2023, 1, 2, 3, 30), 3},
+		{"cron ticks missed", everyQuarter, date(2023, 1, 2, 10, 5), date(2023, 1, 2, 10, 50), 3},
+		{"cron from a tick", everyQuarter, date(2023, 1, 2, 10, 0), date(2023, 1, 2, 10, 45), 2},
+		{"no more tick", never, date(2023, 1, 2, 0, 0), date(2023, 1, 3, 0, 0), 0},
+	}
+	for _, test := range tests {
+		scheduler := NewScheduler(test.schedule, 0, false)
+		if actual := scheduler.countTicks(test.from, test.to); actual != test.expected {
+			t.Errorf("%s: expected %d skipped ticks, got %d", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestRandomJitter(t *testing.T) {
+	if jitter := NewScheduler(IntervalSchedule{Interval: time.Hour}, 0, false).randomJitter(); jitter != 0 {
+		t.Errorf("no jitter expected, got %s", jitter)
+	}
+	scheduler := NewScheduler(IntervalSchedule{Interval: time.Hour}, time.Second, false)
+	for i := 0; i < 1000; i++ {
+		if jitter := scheduler.randomJitter(); jitter < 0 || jitter > time.Second {
+			t.Fatalf("jitter out of bounds: %s", jitter)
+		}
+	}
+}
+
+func TestRunAtStartup(t *testing.T) {
+	initializeLogger(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := 0
+	scheduler := NewScheduler(IntervalSchedule{Interval: time.Hour}, 0, true)
+	scheduler.Run(ctx, func() error {
+		runs++
+		cancel()
+		return nil
+	})
+	if runs != 1 {
+		t.Errorf("unexpected number of runs: %d", runs)
+	}
+}
+
+func TestRunKeepsGoingAfterAFailure(t *testing.T) {
+	initializeLogger(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runs := 0
+	scheduler := NewScheduler(IntervalSchedule{Interval: 10 * time.Millisecond}, 0, false)
+	scheduler.Run(ctx, func() error {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+		return errors.New("failure")
+	})
+	if runs != 3 {
+		t.Errorf("unexpected number of runs: %d", runs)
+	}
+}
+
+func TestRunStopsWhenTheScheduleEnds(t *testing.T) {
+	initializeLogger(t)
+	runs := 0
+	var last time.Time
+	scheduler := NewScheduler(scheduleFunc(func(after time.Time) time.Time {
+		if !last.IsZero() {
+			return time.Time{}
+		}
+		last = after.Add(10 * time.Millisecond)
+		return last
+	}), 0, false)
+	scheduler.Run(context.Background(), func() error {
+		runs++
+		return nil
+	})
+	if runs != 1 {
+		t.Errorf("unexpected number of runs: %d", runs)
+	}
+}
@@ -10,6 +10,11 @@ var mutex sync.Mutex
 type SettingsService struct {
 	SilentMode               bool
 	SynchronizationRequested bool
+	DryRun                   bool
+	DaemonRequested          bool
+	RebucketRequested        bool
+	// RulesTestVideoId is the video whose routing by the rules is explained, empty if not requested.
+	RulesTestVideoId string
 }
 
 func GetSettingsService() *SettingsService {
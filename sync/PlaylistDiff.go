@@ -0,0 +1,89 @@
+package sync
+
+import "reflect"
+
+// PlaylistDiff represents the changes turning the current content of a playlist into the expected one.
+type PlaylistDiff struct {
+	// AddedVideoIds are the videos to append at the end of the playlist.
+	AddedVideoIds []string
+	// RemovedIndexes are the positions of the videos to remove from the current content, in decreasing order
+	// so that each removal doesn't shift the next ones.
+	RemovedIndexes []int
+	// RemovedVideoIds are the videos located at RemovedIndexes.
+	RemovedVideoIds []string
+	// Rebuild tells that the whole content is appended again then the former entries removed, to restore the order.
+	Rebuild bool
+}
+
+// computePlaylistDiff returns the smallest set of changes giving the expected videos to a playlist.
+//
+// The videos already present are left in place: the missing ones are appended, in the expected order,
+// and the unexpected ones (including the duplicates) are removed.
+func computePlaylistDiff(currentVideoIds []string, expectedVideoIds []string) PlaylistDiff {
+	var diff PlaylistDiff
+	expected := make(map[string]struct{}, len(expectedVideoIds))
+	for _, videoId := range expectedVideoIds {
+		expected[videoId] = struct{}{}
+	}
+	present := make(map[string]struct{}, len(currentVideoIds))
+	for index, videoId := range currentVideoIds {
+		_, isExpected := expected[videoId]
+		_, isDuplicate := present[videoId]
+		if isExpected && !isDuplicate {
+			present[videoId] = struct{}{}
+		} else {
+			diff.RemovedIndexes = append([]int{index}, diff.RemovedIndexes...)
+			diff.RemovedVideoIds = append([]string{videoId}, diff.RemovedVideoIds...)
+		}
+	}
+	for _, videoId := range expectedVideoIds {
+		if _, isPresent := present[videoId]; !isPresent {
+			diff.AddedVideoIds = append(diff.AddedVideoIds, videoId)
+			present[videoId] = struct{}{}
+		}
+	}
+	return diff
+}
+
+// computeOrderedPlaylistDiff returns the changes giving the expected videos to a playlist, in the expected order.
+//
+// Since the videos can only be appended, the playlist is rebuilt whenever a new video has to be placed before the
+// existing ones: every expected video is appended, then all the former entries are removed. Like for any other
+// diff, the playlist never gets empty, even if a call fails in between.
+func computeOrderedPlaylistDiff(currentVideoIds []string, expectedVideoIds []string) PlaylistDiff {
+	diff := computePlaylistDiff(currentVideoIds, expectedVideoIds)
+	removed := make(map[int]struct{}, len(diff.RemovedIndexes))
+	for _, index := range diff.RemovedIndexes {
+		removed[index] = struct{}{}
+	}
+	var resultVideoIds []string
+	for index, videoId := range currentVideoIds {
+		if _, isRemoved := removed[index]; !isRemoved {
+			resultVideoIds = append(resultVideoIds, videoId)
+		}
+	}
+	resultVideoIds = append(resultVideoIds, diff.AddedVideoIds...)
+	if reflect.DeepEqual(resultVideoIds, expectedVideoIds) {
+		return diff
+	}
+	rebuild := PlaylistDiff{
+		AddedVideoIds: expectedVideoIds,
+		Rebuild:       true,
+	}
+	for index := len(currentVideoIds) - 1; index >= 0; index-- {
+		rebuild.RemovedIndexes = append(rebuild.RemovedIndexes, index)
+		rebuild.RemovedVideoIds = append(rebuild.RemovedVideoIds, currentVideoIds[index])
+	}
+	return rebuild
+}
+
+// isEmpty tells if the playlist is already up-to-date.
+func (diff PlaylistDiff) isEmpty() bool {
+	return len(diff.AddedVideoIds) == 0 && len(diff.RemovedIndexes) == 0
+}
+
+func reverse(videoIds []string) {
+	for i, j := 0, len(videoIds)-1; i < j; i, j = i+1, j-1 {
+		videoIds[i], videoIds[j] = videoIds[j], videoIds[i]
+	}
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestComputePlaylistDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []string
+		expected []string
+		diff     PlaylistDiff
+	}{
+		{"unchanged", []string{"a", "b", "c"}, []string{"a", "b", "c"}, PlaylistDiff{}},
+		{"unchanged but reordered", []string{"c", "a", "b"}, []string{"a", "b", "c"}, PlaylistDiff{}},
+		{"both empty", nil, nil, PlaylistDiff{}},
+		{"new playlist", nil, []string{"a", "b"}, PlaylistDiff{AddedVideoIds: []string{"a", "b"}}},
+		{"emptied playlist", []string{"a", "b"}, nil,
+			PlaylistDiff{RemovedIndexes: []int{1, 0}, RemovedVideoIds: []string{"b", "a"}}},
+		{"added and removed", []string{"a", "x", "b", "y"}, []string{"a", "b", "c", "d"},
+			PlaylistDiff{AddedVideoIds: []string{"c", "d"}, RemovedIndexes: []int{3, 1}, RemovedVideoIds: []string{"y", "x"}}},
+		{"duplicates in the playlist", []string{"a", "b", "a", "a", "b"}, []string{"a", "b"},
+			PlaylistDiff{RemovedIndexes: []int{4, 3, 2}, RemovedVideoIds: []string{"b", "a", "a"}}},
+		{"unexpected duplicates in the playlist", []string{"x", "a", "x"}, []string{"a"},
+			PlaylistDiff{RemovedIndexes: []int{2, 0}, RemovedVideoIds: []string{"x", "x"}}},
+		{"duplicates expected", []string{"a"}, []string{"a", "b", "a", "b"},
+			PlaylistDiff{AddedVideoIds: []string{"b"}}},
+	}
+	for _, test := range tests {
+		diff := computePlaylistDiff(test.current, test.expected)
+		if !reflect.DeepEqual(diff, test.diff) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.diff, diff)
+		}
+		if diff.isEmpty() != (len(test.diff.AddedVideoIds) == 0 && len(test.diff.RemovedIndexes) == 0) {
+			t.Errorf("%s: unexpected emptiness of %+v", test.name, diff)
+		}
+		assertDiffApplied(t, test.name, test.current, diff, test.expected, false)
+	}
+}
+
+func TestComputeOrderedPlaylistDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []string
+		expected []string
+		rebuild  bool
+	}{
+		{"unchanged", []string{"a", "b", "c"}, []string{"a", "b", "c"}, false},
+		{"appended", []string{"a", "b"}, []string{"a", "b", "c"}, false},
+		{"removed", []string{"a", "b", "c"}, []string{"a", "c"}, false},
+		{"prepended", []string{"b", "c"}, []string{"a", "b", "c"}, true},
+		{"reversed", []string{"a", "b", "c"}, []string{"c", "b", "a"}, true},
+		{"duplicates in the playlist", []string{"b", "a", "b"}, []string{"a", "b"}, true},
+	}
+	for _, test := range tests {
+		diff := computeOrderedPlaylistDiff(test.current, test.expected)
+		if diff.Rebuild != test.rebuild {
+			t.Errorf("%s: unexpected rebuild of %+v", test.name, diff)
+		}
+		if test.rebuild && !reflect.DeepEqual(diff.AddedVideoIds, test.expected) {
+			t.Errorf("%s: all the videos are expected to be appended again, got %+v", test.name, diff)
+		}
+		assertDiffApplied(t, test.name, test.current, diff, test.expected, true)
+	}
+}
+
+// assertDiffApplied applies a diff the way the synchronization does, adding before removing, and checks the result.
+func assertDiffApplied(t *testing.T, name string, current []string, diff PlaylistDiff, expected []string, ordered bool) {
+	t.Helper()
+	if !sort.SliceIsSorted(diff.RemovedIndexes, func(i, j int) bool { return diff.RemovedIndexes[i] > diff.RemovedIndexes[j] }) {
+		t.Errorf("%s: the removed indexes are not in decreasing order: %v", name, diff.RemovedIndexes)
+	}
+	for i := 1; i < len(diff.RemovedIndexes); i++ {
+		if diff.RemovedIndexes[i] == diff.RemovedIndexes[i-1] {
+			t.Errorf("%s: the index %d is removed twice", name, diff.RemovedIndexes[i])
+		}
+	}
+	playlist := append(append([]string{}, current...), diff.AddedVideoIds...)
+	for i, index := range diff.RemovedIndexes {
+		if index < 0 || index >= len(current) {
+			t.Errorf("%s: the index %d is out of the current content", name, index)
+			return
+		}
+		if playlist[index] != diff.RemovedVideoIds[i] {
+			t.Errorf("%s: the index %d holds '%s', not '%s'", name, index, playlist[index], diff.RemovedVideoIds[i])
+		}
+		playlist = append(playlist[:index], playlist[index+1:]...)
+	}
+	if ordered {
+		if !reflect.DeepEqual(playlist, expected) && !(len(playlist) == 0 && len(expected) == 0) {
+			t.Errorf("%s: expected %v once applied, got %v", name, expected, playlist)
+		}
+		return
+	}
+	expectedSet := make(map[string]struct{})
+	for _, videoId := range expected {
+		expectedSet[videoId] = struct{}{}
+	}
+	actualSet := make(map[string]struct{})
+	for _, videoId := range playlist {
+		if _, isDuplicate := actualSet[videoId]; isDuplicate {
+			t.Errorf("%s: '%s' is duplicated once applied: %v", name, videoId, playlist)
+		}
+		actualSet[videoId] = struct{}{}
+	}
+	if !reflect.DeepEqual(actualSet, expectedSet) {
+		t.Errorf("%s: expected %v once applied, got %v", name, expected, playlist)
+	}
+}
@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"fmt"
+	"github.com/frajibe/piped-playfeed/rules"
+	"github.com/frajibe/piped-playfeed/utils"
+)
+
+// RulesExplanation represents how the rules route a video, see SynchronizationService.ExplainRules.
+type RulesExplanation struct {
+	VideoId    string
+	UploadDate string
+	Video      rules.Video
+	// Evaluations are the outcomes of the rules evaluated until the rule deciding the fate of the video.
+	Evaluations []rules.Evaluation
+	Ignored     bool
+	// Playlists are the names of the playlists receiving the video.
+	Playlists []string
+}
+
+// Print writes the explanation into the console.
+func (explanation *RulesExplanation) Print() {
+	console := utils.GetLoggingService().Console
+	video := explanation.Video
+	console(fmt.Sprintf("Video '%s': '%s'", explanation.VideoId, video.Title))
+	console(fmt.Sprintf("    channel '%s', %ds, category '%s', uploaded on %s %s", video.ChannelId, video.Duration, video.Category, video.Weekday, explanation.UploadDate))
+
+	console(fmt.Sprintf("- %d rules evaluated", len(explanation.Evaluations)))
+	for _, evaluation := range explanation.Evaluations {
+		if evaluation.Matched {
+			console(fmt.Sprintf("    '%s': matched, action '%s'", evaluation.Rule.Name, evaluation.Rule.Action))
+		} else {
+			console(fmt.Sprintf("    '%s': not matched, %s", evaluation.Rule.Name, evaluation.Reason))
+		}
+	}
+
+	if explanation.Ignored {
+		console("- ignored")
+		return
+	}
+	console(fmt.Sprintf("- %d playlists", len(explanation.Playlists)))
+	for _, playlistName := range explanation.Playlists {
+		console(fmt.Sprintf("    '%s'", playlistName))
+	}
+}
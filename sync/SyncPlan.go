@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"fmt"
+	"github.com/frajibe/piped-playfeed/utils"
+	"sort"
+)
+
+// SyncPlan represents the changes a synchronization would apply, gathered in dry-run mode.
+type SyncPlan struct {
+	PlaylistsToCreate   []string
+	PlaylistsToDelete   []string
+	PlaylistRenames     []PlaylistRename
+	VideosToAdd         map[string][]string
+	VideosToRemove      map[string][]string
+	VideosMarkedRemoved []string
+	ChannelCursorMoves  []ChannelCursorMove
+}
+
+// ChannelCursorMove represents the move of the last video date of a channel.
+type ChannelCursorMove struct {
+	Channel string
+	From    string
+	To      string
+}
+
+// PlaylistRename represents the rename of a playlist whose name doesn't match the template anymore.
+type PlaylistRename struct {
+	From string
+	To   string
+}
+
+func newSyncPlan() *SyncPlan {
+	return &SyncPlan{
+		VideosToAdd:    make(map[string][]string),
+		VideosToRemove: make(map[string][]string),
+	}
+}
+
+// addPlaylistDiff records the changes planned on a playlist.
+func (plan *SyncPlan) addPlaylistDiff(playlistName string, diff PlaylistDiff) {
+	if len(diff.AddedVideoIds) != 0 {
+		plan.VideosToAdd[playlistName] = diff.AddedVideoIds
+	}
+	if len(diff.RemovedVideoIds) != 0 {
+		plan.VideosToRemove[playlistName] = diff.RemovedVideoIds
+	}
+}
+
+// Print writes the plan into the console.
+func (plan *SyncPlan) Print() {
+	console := utils.GetLoggingService().Console
+	console("Dry run, nothing has been written. Planned changes:")
+
+	console(fmt.Sprintf("- %d playlists to create", len(plan.PlaylistsToCreate)))
+	for _, playlistName := range plan.PlaylistsToCreate {
+		console(fmt.Sprintf("    '%s'", playlistName))
+	}
+
+	console(fmt.Sprintf("- %d playlists to delete", len(plan.PlaylistsToDelete)))
+	for _, playlistName := range plan.PlaylistsToDelete {
+		console(fmt.Sprintf("    '%s'", playlistName))
+	}
+
+	console(fmt.Sprintf("- %d playlists to rename", len(plan.PlaylistRenames)))
+	for _, rename := range plan.PlaylistRenames {
+		console(fmt.Sprintf("    '%s' -> '%s'", rename.From, rename.To))
+	}
+
+	printVideosByPlaylist("add", plan.VideosToAdd)
+	printVideosByPlaylist("remove from the playlists", plan.VideosToRemove)
+
+	console(fmt.Sprintf("- %d videos to mark as removed", len(plan.VideosMarkedRemoved)))
+	for _, videoId := range plan.VideosMarkedRemoved {
+		console(fmt.Sprintf("    %s", videoId))
+	}
+
+	console(fmt.Sprintf("- %d channels whose last video date moves", len(plan.ChannelCursorMoves)))
+	for _, move := range plan.ChannelCursorMoves {
+		console(fmt.Sprintf("    '%s': %s -> %s", move.Channel, move.From, move.To))
+	}
+}
+
+func printVideosByPlaylist(action string, videosByPlaylist map[string][]string) {
+	console := utils.GetLoggingService().Console
+	var playlistNames []string
+	videosCount := 0
+	for playlistName, videoIds := range videosByPlaylist {
+		playlistNames = append(playlistNames, playlistName)
+		videosCount += len(videoIds)
+	}
+	sort.Strings(playlistNames)
+	console(fmt.Sprintf("- %d videos to %s", videosCount, action))
+	for _, playlistName := range playlistNames {
+		console(fmt.Sprintf("    '%s': %d videos", playlistName, len(videosByPlaylist[playlistName])))
+		for _, videoId := range videosByPlaylist[playlistName] {
+			console(fmt.Sprintf("        %s", videoId))
+		}
+	}
+}
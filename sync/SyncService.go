@@ -1,22 +1,34 @@
 package sync
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/frajibe/piped-playfeed/bucket"
 	"github.com/frajibe/piped-playfeed/config"
 	"github.com/frajibe/piped-playfeed/config/model"
 	"github.com/frajibe/piped-playfeed/db"
 	channelDb "github.com/frajibe/piped-playfeed/db/channel"
 	dbCommon "github.com/frajibe/piped-playfeed/db/common"
+	metadataDb "github.com/frajibe/piped-playfeed/db/metadata"
+	playlistDb "github.com/frajibe/piped-playfeed/db/playlist"
+	runDb "github.com/frajibe/piped-playfeed/db/run"
+	upcomingDb "github.com/frajibe/piped-playfeed/db/upcoming"
 	videoDb "github.com/frajibe/piped-playfeed/db/video"
 	pipedApi "github.com/frajibe/piped-playfeed/piped/api"
 	pipedDto "github.com/frajibe/piped-playfeed/piped/dto"
 	pipedPlaylistDto "github.com/frajibe/piped-playfeed/piped/dto/playlist"
 	pipedVideoDto "github.com/frajibe/piped-playfeed/piped/dto/video"
+	"github.com/frajibe/piped-playfeed/rules"
+	"github.com/frajibe/piped-playfeed/settings"
 	"github.com/frajibe/piped-playfeed/utils"
-	"strconv"
+	"html"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,6 +36,25 @@ var instance *SynchronizationService
 var mutex sync.Mutex
 
 type SynchronizationService struct {
+	pipedClient *pipedApi.Client
+	// plan gathers the changes instead of applying them on the Piped instance, nil unless in dry-run mode
+	plan *SyncPlan
+	// stopping tells that the indexing must stop after the current channel, see Stop
+	stopping atomic.Bool
+	// namers render the names of the playlists by group name, and calendar determines their buckets, according to the
+	// configuration
+	namers   map[string]*bucket.Namer
+	calendar *bucket.Calendar
+	// channelGroups are the channel groups of the configuration, by channel id
+	channelGroups map[string]model.ChannelGroup
+	// rulesEngine routes the videos matching the rules of the configuration
+	rulesEngine *rules.Engine
+	// channelShorts are the shorts policies of the configuration overriding the global one, by channel id
+	channelShorts map[string]string
+	// channelVideoDurations are the duration filters of the configuration overriding the global one, by channel id
+	channelVideoDurations map[string]model.DurationFilter
+	// channelPriorities are the ranks of the channels filling the budgeted playlists first, by channel id
+	channelPriorities map[string]int
 }
 
 func GetSynchronizationServiceInstance() *SynchronizationService {
@@ -37,58 +68,411 @@ func GetSynchronizationServiceInstance() *SynchronizationService {
 	return instance
 }
 
-func (syncService *SynchronizationService) Synchronize() error {
+// Init initializes the service using the client of the Piped instance to synchronize.
+func (syncService *SynchronizationService) Init(pipedClient *pipedApi.Client) {
+	syncService.pipedClient = pipedClient
+}
+
+// Synchronize updates the playlists according to the new videos of the subscriptions.
+//
+// In dry-run mode, the planned changes are printed instead of being applied.
+func (syncService *SynchronizationService) Synchronize(ctx context.Context) error {
+	defer syncService.reportInstancesHealth()
+	syncService.plan = nil
+	if settings.GetSettingsService().DryRun {
+		syncService.plan = newSyncPlan()
+	}
+	err := syncService.synchronize(ctx)
+	if err == nil && syncService.plan != nil {
+		syncService.plan.Print()
+	}
+	return err
+}
+
+// Stop requests the running synchronization to end as soon as the current channel is indexed.
+//
+// The playlists are still updated with the videos indexed so far, so that the database and the Piped instance stay
+// consistent. Cancel the context of Synchronize to stop immediately instead.
+func (syncService *SynchronizationService) Stop() {
+	syncService.stopping.Store(true)
+}
+
+func (syncService *SynchronizationService) synchronize(ctx context.Context) error {
+	if err := syncService.initBuckets(); err != nil {
+		return err
+	}
+
+	// resume the interrupted synchronization if any, so that the videos it indexed reach the playlists
+	syncRunRepository := db.GetDatabaseServiceInstance().SyncRunRepository
+	syncRun, err := syncService.startRun(syncRunRepository)
+	if err != nil {
+		return utils.WrapError("unable to start the synchronization in database", err)
+	}
+
 	// fetch the user subscriptions
 	utils.GetLoggingService().Debug("Fetching subscriptions")
-	pipedSubscriptions, err := syncService.fetchSubscriptions()
+	pipedSubscriptions, err := syncService.fetchSubscriptions(ctx)
 	if err != nil {
 		return err
 	}
 	if len(*pipedSubscriptions) == 0 {
 		utils.GetLoggingService().Console("no subscriptions found, stopping the synchronization")
-		return nil
+		return syncService.finishRun(syncRun, syncRunRepository)
+	}
+	// the playlists dedicated to the renamed channels are renamed along
+	channelRepository := db.GetDatabaseServiceInstance().ChannelRepository
+	for _, pipedSubscription := range *pipedSubscriptions {
+		if err := channelRepository.Rename(pipedApi.ExtractChannelIdFromUrl(pipedSubscription.Url), pipedSubscription.Name); err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to update the name of the channel '%s' in database", pipedSubscription.Name), err)
+		}
 	}
 
 	// fetch the subscribed channels
 	utils.GetLoggingService().Debug("Fetching playlists")
 	playlistProgressBar := utils.CreateInfiniteProgressBar("[2/5] Fetching playlists...")
-	pipedPlaylists, err := syncService.fetchPlaylistsMap()
+	playlistRepository := db.GetDatabaseServiceInstance().PlaylistRepository
+	pipedPlaylists, err := syncService.fetchPlaylistsMap(ctx, playlistRepository)
 	if err != nil {
 		return utils.WrapError("unable to retrieve the playlists from the Piped instance", err)
 	}
 	utils.FinalizeProgressBar(playlistProgressBar, len(*pipedPlaylists))
+	err = syncService.renamePlaylists(ctx, pipedPlaylists, playlistRepository, channelRepository)
+	if err != nil {
+		return utils.WrapError("unable to rename the playlists of the Piped instance", err)
+	}
 
 	// sync the db with the existing playlists
 	utils.GetLoggingService().Debug("Synchronizing Piped playlists to database")
 	videoRepository := db.GetDatabaseServiceInstance().VideoRepository
-	err = syncService.syncPipedPlaylistsToDb(pipedPlaylists, videoRepository)
+	metadataRepository := db.GetDatabaseServiceInstance().MetadataRepository
+	err = syncService.syncPipedPlaylistsToDb(ctx, pipedPlaylists, syncRun, videoRepository, syncRunRepository, metadataRepository)
 	if err != nil {
 		return utils.WrapError("unable to synchronize the playlists in database", err)
 	}
 
 	// index the channel videos
 	utils.GetLoggingService().Debug("Indexing Piped channels videos to database")
-	channelRepository := db.GetDatabaseServiceInstance().ChannelRepository
-	playlistsToUpdate, err := syncService.indexChannelVideos(pipedSubscriptions, channelRepository, videoRepository)
+	upcomingRepository := db.GetDatabaseServiceInstance().UpcomingRepository
+	completed, err := syncService.indexChannelVideos(ctx, pipedSubscriptions, syncRun, channelRepository, videoRepository, syncRunRepository, metadataRepository, upcomingRepository)
 	if err != nil {
 		return utils.WrapError("unable to index the channels videos into the database", err)
 	}
-	if len(playlistsToUpdate) == 0 {
+	// the premieres and livestreams found before their publication are filed once published
+	err = syncService.checkUpcomingVideos(ctx, syncRun, videoRepository, syncRunRepository, metadataRepository, upcomingRepository)
+	if err != nil {
+		return utils.WrapError("unable to check the upcoming videos", err)
+	}
+	// the rolling playlists lose their old videos even if there is no new one
+	for _, rollingBucket := range syncService.determineRollingBuckets() {
+		if err := syncRunRepository.SetBucketDirty(syncRun.Id, rollingBucket.Id); err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to mark the rolling playlist as dirty in database '%s'", rollingBucket.Id), err)
+		}
+	}
+	err = syncService.applyBudget(syncRun, videoRepository, syncRunRepository)
+	if err != nil {
+		return utils.WrapError("unable to apply the watch-time budget of the playlists", err)
+	}
+	bucketsToUpdate, err := syncRunRepository.GetDirtyBuckets(syncRun.Id)
+	if err != nil {
+		return utils.WrapError("unable to read the playlists to update from the database", err)
+	}
+	if len(*bucketsToUpdate) == 0 {
 		utils.GetLoggingService().Console("No new videos found, stopping the synchronization")
+	} else {
+		// sync the piped playlists with the db
+		err = syncService.syncPipedPlaylistsFromDb(ctx, *bucketsToUpdate, syncRun, videoRepository, syncRunRepository, playlistRepository, channelRepository)
+		if err != nil {
+			return utils.WrapError("unable to synchronize the Piped instance playlists", err)
+		}
+	}
+
+	// complete the metadata of the videos indexed from the listings or by the former versions, a few at a time
+	if syncService.plan == nil {
+		syncService.backfillMetadata(ctx, metadataRepository)
+	}
+
+	// the synchronization stopped early is resumed by the next one
+	if !completed {
 		return nil
 	}
+	return syncService.finishRun(syncRun, syncRunRepository)
+}
+
+// initBuckets prepares the namers, the calendar, the channel groups and the rules of the playlists, according to the
+// configuration.
+func (syncService *SynchronizationService) initBuckets() error {
+	synchronization := config.GetConfigurationServiceInstance().Configuration.Synchronization
+	namer, err := bucket.NewNamer(synchronization.PlaylistPrefix, synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+	if err != nil {
+		return err
+	}
+	calendar, err := bucket.NewCalendar(synchronization.WeekStart, synchronization.Timezone)
+	if err != nil {
+		return err
+	}
+	syncService.namers = map[string]*bucket.Namer{"": namer}
+	syncService.calendar = calendar
+	syncService.channelGroups = make(map[string]model.ChannelGroup)
+	for _, channelGroup := range synchronization.ChannelGroups {
+		groupNamer, err := bucket.NewNamer(channelGroup.PlaylistPrefix, synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+		if err != nil {
+			return err
+		}
+		syncService.namers[channelGroup.Name] = groupNamer
+		for _, channel := range channelGroup.Channels {
+			syncService.channelGroups[pipedApi.ExtractChannelIdFromUrl(channel)] = channelGroup
+		}
+	}
+	// the playlists of a rule are handled as a group named after the rule
+	for _, rule := range synchronization.Rules {
+		if strings.EqualFold(rule.Action, model.RuleActionIgnore) {
+			continue
+		}
+		ruleNamer, err := bucket.NewNamer(synchronization.PlaylistPrefix, rule.Playlist, synchronization.Locale, synchronization.RollingDays)
+		if err != nil {
+			return err
+		}
+		syncService.namers[rule.Name] = ruleNamer
+	}
+	rulesEngine, err := rules.NewEngine(synchronization.Rules, synchronization.RulesMode)
+	if err != nil {
+		return err
+	}
+	syncService.rulesEngine = rulesEngine
+	shortsNamer, err := bucket.NewNamer(synchronization.PlaylistPrefix+synchronization.ShortsPlaylistPrefix, synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+	if err != nil {
+		return err
+	}
+	syncService.namers[model.ShortsGroup] = shortsNamer
+	syncService.channelShorts = make(map[string]string)
+	for channel, shorts := range synchronization.ChannelShorts {
+		syncService.channelShorts[pipedApi.ExtractChannelIdFromUrl(channel)] = shorts
+	}
+	syncService.channelVideoDurations = make(map[string]model.DurationFilter)
+	for channel, durationFilter := range synchronization.ChannelVideoDurations {
+		syncService.channelVideoDurations[pipedApi.ExtractChannelIdFromUrl(channel)] = durationFilter
+	}
+	syncService.channelPriorities = make(map[string]int)
+	for rank, channel := range synchronization.Budget.ChannelPriorities {
+		channelId := pipedApi.ExtractChannelIdFromUrl(channel)
+		if _, present := syncService.channelPriorities[channelId]; !present {
+			syncService.channelPriorities[channelId] = rank
+		}
+	}
+	return nil
+}
+
+// Rebucket files again the videos of the weekly playlists according to the calendar of the configuration, moving the
+// ones filed into a wrong week (by the former versions, or before a change of the first day of the week).
+//
+// Nothing is pushed to the Piped instance: the playlists are updated by the next synchronization, which resumes the
+// synchronization started here.
+func (syncService *SynchronizationService) Rebucket() error {
+	if err := syncService.initBuckets(); err != nil {
+		return err
+	}
+	syncRunRepository := db.GetDatabaseServiceInstance().SyncRunRepository
+	syncRun, err := syncService.startRun(syncRunRepository)
+	if err != nil {
+		return utils.WrapError("unable to start the synchronization in database", err)
+	}
+	videoRepository := db.GetDatabaseServiceInstance().VideoRepository
+	var videos []videoDb.SubscriptionVideo
+	for group := range syncService.namers {
+		groupVideos, err := videoRepository.GetByBucketPrefix(bucket.IdPrefix(bucket.StrategyWeek, group))
+		if err != nil {
+			return utils.WrapError("unable to read the videos of the weekly playlists from database", err)
+		}
+		videos = append(videos, *groupVideos...)
+	}
 
-	// sync the piped playlists with the db
-	err = syncService.syncPipedPlaylistsFromDb(playlistsToUpdate, videoRepository)
+	tx, err := db.GetDatabaseServiceInstance().Begin()
 	if err != nil {
-		return utils.WrapError("unable to synchronize the Piped instance playlists", err)
+		return utils.WrapError("can't start a transaction to move the videos", err)
+	}
+	defer tx.Rollback()
+	movedCount := 0
+	formerBucketIds := make(map[string]bool)
+	for _, video := range videos {
+		videoDate, err := syncService.calendar.ParseDay(video.UploadDate)
+		if err != nil {
+			utils.GetLoggingService().WarnFromError(utils.WrapError(fmt.Sprintf("invalid upload date for the video '%s'", video.Id), err))
+			continue
+		}
+		currentBucket := syncService.calendar.Parse(video.Bucket)
+		videoBucket := syncService.calendar.ForDate(videoDate, bucket.StrategyWeek).InGroup(currentBucket.Group)
+		if videoBucket.Id == video.Bucket {
+			continue
+		}
+		// the videos carried over to a later week by the watch-time budget stay there
+		if syncService.carriesOverBudget(currentBucket) && currentBucket.Start.After(videoBucket.Start) {
+			continue
+		}
+		utils.GetLoggingService().Debug(fmt.Sprintf("Moving the video '%s' from '%s' to '%s'", video.Id, video.Bucket, videoBucket.Id))
+		// both playlists have to be pushed: the video is removed from the former one, and added to the new one
+		formerBucketId := video.Bucket
+		for _, dirtyBucket := range []string{formerBucketId, videoBucket.Id} {
+			if err := syncRunRepository.SetBucketDirtyTx(tx, syncRun.Id, dirtyBucket); err != nil {
+				return utils.WrapError(fmt.Sprintf("can't mark the playlist as dirty in database '%s'", dirtyBucket), err)
+			}
+		}
+		video.Bucket = videoBucket.Id
+		if _, err := videoRepository.UpdateTx(tx, video.Id, formerBucketId, video); err != nil {
+			return utils.WrapError(fmt.Sprintf("can't move the video in database '%s'", video.Id), err)
+		}
+		formerBucketIds[formerBucketId] = true
+		movedCount++
+	}
+	// the emptied playlists are deleted by the next synchronization
+	var emptiedPlaylistNames []string
+	for formerBucketId := range formerBucketIds {
+		count, err := videoRepository.CountByBucketTx(tx, formerBucketId)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("can't count the videos left in database '%s'", formerBucketId), err)
+		}
+		if count == 0 {
+			playlistName, err := syncService.nameBucket(syncService.calendar.Parse(formerBucketId), db.GetDatabaseServiceInstance().ChannelRepository)
+			if err != nil {
+				return err
+			}
+			emptiedPlaylistNames = append(emptiedPlaylistNames, playlistName)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.WrapError("can't save the moved videos in database", err)
+	}
+	msg := fmt.Sprintf("%d videos filed into another weekly playlist", movedCount)
+	utils.GetLoggingService().Info(msg)
+	utils.GetLoggingService().Console(msg)
+	if len(emptiedPlaylistNames) != 0 {
+		sort.Strings(emptiedPlaylistNames)
+		msg := fmt.Sprintf("%d weekly playlists left empty, to be deleted: '%s'", len(emptiedPlaylistNames), strings.Join(emptiedPlaylistNames, "', '"))
+		utils.GetLoggingService().Info(msg)
+		utils.GetLoggingService().Console(msg)
 	}
 	return nil
 }
 
-func (syncService *SynchronizationService) fetchSubscriptions() (*[]pipedDto.SubscriptionDto, error) {
+// ExplainRules returns how the rules of the configuration route a video, and the playlists it would go to.
+//
+// Nothing is written: the video is evaluated as if it was a new video of its channel.
+func (syncService *SynchronizationService) ExplainRules(ctx context.Context, videoId string) (*RulesExplanation, error) {
+	if err := syncService.initBuckets(); err != nil {
+		return nil, err
+	}
+	pipedVideo, err := syncService.pipedClient.FetchVideo(ctx, pipedVideoDto.RelatedStreamDto{Url: "/watch?v=" + videoId})
+	if err != nil {
+		return nil, utils.WrapError(fmt.Sprintf("unable to retrieve details for the video '%s'", videoId), err)
+	}
+	videoDate, err := syncService.calendar.ParseDay(pipedVideo.UploadDate)
+	if err != nil {
+		return nil, utils.WrapError(fmt.Sprintf("invalid upload date for the video '%s'", videoId), err)
+	}
+	channelId := pipedApi.ExtractChannelIdFromUrl(pipedVideo.UploaderUrl)
+	rulesVideo := syncService.toRulesVideo(*pipedVideo, channelId, videoDate)
+	explanation := &RulesExplanation{
+		VideoId:     videoId,
+		UploadDate:  pipedVideo.UploadDate,
+		Video:       rulesVideo,
+		Evaluations: syncService.rulesEngine.Evaluate(rulesVideo),
+	}
+	videoBuckets, err := syncService.determineBucketsForVideo(*pipedVideo, channelId, syncService.determineStrategyForChannel(channelId))
+	if err != nil {
+		return nil, utils.WrapError(fmt.Sprintf("Unable to determine the playlist for the video '%s'", videoId), err)
+	}
+	channelRepository := db.GetDatabaseServiceInstance().ChannelRepository
+	for _, videoBucket := range videoBuckets {
+		if videoBucket.IsIgnored() {
+			explanation.Ignored = true
+			continue
+		}
+		playlistName, err := syncService.nameBucket(videoBucket, channelRepository)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Playlists = append(explanation.Playlists, playlistName)
+	}
+	return explanation, nil
+}
+
+// backfillMetadata completes the metadata of the known videos from their details, up to the configured number of videos.
+//
+// The failures are only logged, the remaining videos being completed by the next synchronizations.
+func (syncService *SynchronizationService) backfillMetadata(ctx context.Context, metadataRepository *metadataDb.SQLiteMetadataRepository) {
+	limit := config.GetConfigurationServiceInstance().Configuration.Synchronization.MetadataBackfill
+	videoIds, err := metadataRepository.GetIdsToBackfill(limit)
+	if err != nil {
+		utils.GetLoggingService().WarnFromError(utils.WrapError("unable to read the videos to complete from database", err))
+		return
+	}
+	if len(*videoIds) == 0 {
+		return
+	}
+	utils.GetLoggingService().Debug(fmt.Sprintf("Completing the metadata of %d videos", len(*videoIds)))
+	completedCount := 0
+	for _, pipedVideo := range syncService.pipedClient.FetchVideos(ctx, *videoIds) {
+		if pipedVideo == nil {
+			continue
+		}
+		videoMetadata := toVideoMetadata(*pipedVideo, pipedApi.ExtractChannelIdFromUrl(pipedVideo.UploaderUrl), pipedVideo.Uploader)
+		if _, err := metadataRepository.Save(videoMetadata); err != nil {
+			utils.GetLoggingService().WarnFromError(utils.WrapError(fmt.Sprintf("unable to save the metadata of the video in database '%s'", videoMetadata.Id), err))
+			continue
+		}
+		completedCount++
+	}
+	utils.GetLoggingService().Debug(fmt.Sprintf("... %d completed", completedCount))
+}
+
+// startRun returns the interrupted synchronization if any, or a new one.
+func (syncService *SynchronizationService) startRun(syncRunRepository *runDb.SQLiteSyncRunRepository) (*runDb.SyncRun, error) {
+	syncRun, err := syncRunRepository.GetUnfinished()
+	if err == nil {
+		msg := fmt.Sprintf("Resuming the synchronization started at %s", syncRun.StartedAt)
+		utils.GetLoggingService().Info(msg)
+		utils.GetLoggingService().ConsoleProgress(msg)
+		return syncRun, nil
+	}
+	if !errors.Is(err, dbCommon.ErrNotExists) {
+		return nil, err
+	}
+	return syncRunRepository.Create()
+}
+
+func (syncService *SynchronizationService) finishRun(syncRun *runDb.SyncRun, syncRunRepository *runDb.SQLiteSyncRunRepository) error {
+	if err := syncRunRepository.Finish(syncRun.Id); err != nil {
+		return utils.WrapError("unable to complete the synchronization in database", err)
+	}
+	return nil
+}
+
+func (syncService *SynchronizationService) reportInstancesHealth() {
+	// the account instance is usually part of the read pool
+	healths := []pipedApi.InstanceHealth{syncService.pipedClient.Health()}
+	if readPool := syncService.pipedClient.ReadPool(); readPool != nil {
+		for _, health := range readPool.Health() {
+			if health.BaseUrl != healths[0].BaseUrl {
+				healths = append(healths, health)
+			}
+		}
+	}
+	for _, health := range healths {
+		msg := fmt.Sprintf("Instance '%s': %d requests, %d failures", health.BaseUrl, health.Requests, health.Failures)
+		if health.Paused {
+			msg += ", currently paused"
+		}
+		if health.Failures != 0 {
+			utils.GetLoggingService().Warn(fmt.Sprintf("%s, last error: %s", msg, health.LastError))
+		} else {
+			utils.GetLoggingService().Info(msg)
+		}
+		utils.GetLoggingService().ConsoleProgress(msg)
+	}
+}
+
+func (syncService *SynchronizationService) fetchSubscriptions(ctx context.Context) (*[]pipedDto.SubscriptionDto, error) {
 	subProgressBar := utils.CreateInfiniteProgressBar("[1/5] Fetching subscriptions...")
-	pipedSubscriptions, err := pipedApi.FetchSubscriptions(config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+	pipedSubscriptions, err := syncService.pipedClient.FetchSubscriptions(ctx)
 	if err != nil {
 		return nil, utils.WrapError("unable to retrieve the subscriptions from the Piped instance", err)
 	}
@@ -98,19 +482,19 @@ func (syncService *SynchronizationService) fetchSubscriptions() (*[]pipedDto.Sub
 	return pipedSubscriptions, nil
 }
 
-func (syncService *SynchronizationService) syncPipedPlaylistsToDb(pipedPlaylists *map[string]pipedPlaylistDto.PlaylistDto, subscriptionVideoRepository *videoDb.SQLiteVideoRepository) error {
+func (syncService *SynchronizationService) syncPipedPlaylistsToDb(ctx context.Context, pipedPlaylists *map[string]pipedPlaylistDto.PlaylistDto, syncRun *runDb.SyncRun, subscriptionVideoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, metadataRepository *metadataDb.SQLiteMetadataRepository) error {
 	// retrieve the content of the playlists
-	var playlistsVideosIds []string
+	var playlistsVideos []videoDb.SubscriptionVideo
 	progressBar := utils.CreateProgressBar(len(*pipedPlaylists), "[3/5] Indexing playlists...")
-	for _, pipedPlaylist := range *pipedPlaylists {
-		pipedVideosMeta, err := pipedApi.FetchPlaylistVideos(pipedPlaylist.Id, config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+	for bucketId, pipedPlaylist := range *pipedPlaylists {
+		pipedVideosMeta, err := syncService.pipedClient.FetchPlaylistVideos(ctx, pipedPlaylist.Id)
 		if err != nil {
 			return utils.WrapError("unable to retrieve the playlists videos", err)
 		}
 		for _, pipedVideoMeta := range *pipedVideosMeta {
 			// gather the id of the videos that are part of the playlist
 			videoId := pipedApi.ExtractVideoIdFromUrl(pipedVideoMeta.Url)
-			playlistsVideosIds = append(playlistsVideosIds, videoId)
+			playlistsVideos = append(playlistsVideos, videoDb.SubscriptionVideo{Id: videoId, Bucket: bucketId})
 
 			// ensure that the video is persisted into db (in case the user has manually added a video into the playlist)
 			exist, errExist := subscriptionVideoRepository.Exists(videoId)
@@ -118,7 +502,7 @@ func (syncService *SynchronizationService) syncPipedPlaylistsToDb(pipedPlaylists
 				return utils.WrapError("unable to retrieve the video from database", errExist)
 			}
 			if !exist {
-				pipedVideo, errFetchVideo := pipedApi.FetchVideo(pipedVideoMeta, config.GetConfigurationServiceInstance().Configuration.Instance)
+				pipedVideo, errFetchVideo := syncService.pipedClient.FetchVideo(ctx, pipedVideoMeta)
 				if errFetchVideo != nil {
 					return utils.WrapError(fmt.Sprintf("unable to retrieve details for the video '%s'", pipedVideoMeta.Url), errFetchVideo)
 				}
@@ -127,87 +511,98 @@ func (syncService *SynchronizationService) syncPipedPlaylistsToDb(pipedPlaylists
 					UploadDate: pipedVideo.UploadDate,
 					Uploaded:   pipedVideoMeta.Uploaded,
 					Removed:    0,
-					Playlist:   pipedPlaylist.Name,
+					Bucket:     bucketId,
 				})
 				if errCreateVideo != nil {
 					return utils.WrapError(fmt.Sprintf("Can't create the video in database '%s'", videoId), errCreateVideo)
 				}
+				_, errSaveMetadata := metadataRepository.Save(toVideoMetadata(*pipedVideo, pipedApi.ExtractChannelIdFromUrl(pipedVideo.UploaderUrl), pipedVideo.Uploader))
+				if errSaveMetadata != nil {
+					return utils.WrapError(fmt.Sprintf("Can't save the metadata of the video in database '%s'", videoId), errSaveMetadata)
+				}
 			}
 		}
 		utils.IncrementProgressBar(progressBar)
 	}
 	utils.FinalizeProgressBar(progressBar, len(*pipedPlaylists))
 
-	// tag all the videos that are not part of the playlist as manually removed
-	err := subscriptionVideoRepository.SetAllRemovedExcept(&playlistsVideosIds)
+	// tag all the videos that are not part of the playlist as manually removed,
+	// except the ones not pushed yet by an interrupted synchronization
+	pendingBuckets, err := syncRunRepository.GetDirtyBuckets(syncRun.Id)
 	if err != nil {
-		utils.GetLoggingService().Warn(utils.WrapError("unable to mark videos as manually removed", err).Error())
+		return utils.WrapError("unable to read the playlists to update from the database", err)
+	}
+	if syncService.plan != nil {
+		removedVideoIds, err := subscriptionVideoRepository.GetNotRemovedExcept(&playlistsVideos, pendingBuckets)
+		if err != nil {
+			return utils.WrapError("unable to read the videos to mark as manually removed", err)
+		}
+		syncService.plan.VideosMarkedRemoved = append(syncService.plan.VideosMarkedRemoved, *removedVideoIds...)
+	}
+	if err := subscriptionVideoRepository.SetAllRemovedExcept(&playlistsVideos, pendingBuckets); err != nil {
+		return utils.WrapError("unable to mark videos as manually removed", err)
 	}
 	return nil
 }
 
-func (syncService *SynchronizationService) indexChannelVideos(pipedSubscriptions *[]pipedDto.SubscriptionDto, subscriptionChannelRepository *channelDb.SQLiteChannelRepository, videoRepository *videoDb.SQLiteVideoRepository) ([]string, error) {
-	var relatedPlaylistNames = make(map[string]struct{})
-	playlistPrefix := config.GetConfigurationServiceInstance().Configuration.Synchronization.PlaylistPrefix
-	playlistStrategy := config.GetConfigurationServiceInstance().Configuration.Synchronization.Strategy
+// indexChannelVideos persists the new videos of the subscriptions, and marks their playlists as dirty.
+//
+// The channels already indexed by the synchronization are skipped. False is returned if it stopped before indexing
+// all the channels.
+func (syncService *SynchronizationService) indexChannelVideos(ctx context.Context, pipedSubscriptions *[]pipedDto.SubscriptionDto, syncRun *runDb.SyncRun, subscriptionChannelRepository *channelDb.SQLiteChannelRepository, videoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, metadataRepository *metadataDb.SQLiteMetadataRepository, upcomingRepository *upcomingDb.SQLiteUpcomingVideoRepository) (bool, error) {
+	indexedChannelIds, err := syncRunRepository.GetIndexedChannels(syncRun.Id)
+	if err != nil {
+		return false, utils.WrapError("unable to read the indexed channels from the database", err)
+	}
 	channelProgressBar := utils.CreateProgressBar(len(*pipedSubscriptions), "[4/5] Fetching new channels videos...")
 	newVideosCount := 0
 	for _, pipedSubscription := range *pipedSubscriptions {
-		newPipedVideos, err := syncService.gatherSubscriptionNewVideos(pipedSubscription, subscriptionChannelRepository)
+		if syncService.stopping.Load() {
+			msg := "Stop requested, the remaining channels will be indexed by the next synchronization"
+			utils.GetLoggingService().ConsoleWarn(msg)
+			utils.GetLoggingService().Warn(msg)
+			utils.FinalizeProgressBar(channelProgressBar, len(*pipedSubscriptions))
+			return false, nil
+		}
+		channelId := pipedApi.ExtractChannelIdFromUrl(pipedSubscription.Url)
+		if _, indexed := indexedChannelIds[channelId]; indexed {
+			utils.GetLoggingService().Debug(fmt.Sprintf("Channel '%s' already indexed", pipedSubscription.Name))
+			utils.IncrementProgressBar(channelProgressBar)
+			continue
+		}
+		newPipedVideos, upcomingStreams, subscriptionChannel, err := syncService.gatherSubscriptionNewVideos(ctx, pipedSubscription, subscriptionChannelRepository, videoRepository)
 		if err != nil {
 			msg := fmt.Sprintf("Unable to retrieve new videos for the channel '%s'", pipedSubscription.Name)
 			utils.GetLoggingService().ConsoleWarn(msg)
 			utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
 		} else {
-			for _, newPipedVideo := range *newPipedVideos {
-				videoId := pipedApi.ExtractVideoIdFromUrl(newPipedVideo.Url)
-				_, err := videoRepository.GetById(videoId)
-				// try to add the video into db is not already present
-				if err != nil {
-					if errors.Is(err, dbCommon.ErrNotExists) {
-						// the video is new: create it
-						playlistName, err := syncService.determinePlaylistForVideo(newPipedVideo, playlistPrefix, playlistStrategy)
-						if err != nil {
-							return nil, utils.WrapError(fmt.Sprintf("Unable to determine the playlist name for the video '%s'", newPipedVideo.Url), err)
-						}
-						_, err = videoRepository.Create(videoDb.SubscriptionVideo{
-							Id:         videoId,
-							UploadDate: newPipedVideo.UploadDate,
-							Uploaded:   newPipedVideo.Uploaded,
-							Removed:    0,
-							Playlist:   playlistName,
-						})
-						if err != nil {
-							return nil, utils.WrapError(fmt.Sprintf("Can't create the video in database '%s'", videoId), err)
-						}
-						relatedPlaylistNames[playlistName] = struct{}{}
-						newVideosCount = newVideosCount + 1
-					} else {
-						return nil, utils.WrapError(fmt.Sprintf("Can't read the video from database '%s'", videoId), err)
-					}
-				}
+			count, err := syncService.persistChannelVideos(channelId, pipedSubscription, subscriptionChannel, newPipedVideos, upcomingStreams, syncRun, subscriptionChannelRepository, videoRepository, syncRunRepository, metadataRepository, upcomingRepository)
+			if err != nil {
+				// nothing has been persisted: the channel is indexed again by the next synchronization
+				msg := fmt.Sprintf("Unable to save the new videos of the channel '%s'", pipedSubscription.Name)
+				utils.GetLoggingService().ConsoleWarn(msg)
+				utils.GetLoggingService().WarnFromError(utils.WrapError(msg, err))
 			}
+			newVideosCount = newVideosCount + count
 		}
 		utils.IncrementProgressBar(channelProgressBar)
 	}
 	utils.FinalizeProgressBar(channelProgressBar, len(*pipedSubscriptions))
 	utils.GetLoggingService().Info(fmt.Sprintf("%d new videos found", newVideosCount))
-
-	// determine the playlists to be updated
-	var uniquePlaylistNames []string
-	for key := range relatedPlaylistNames {
-		uniquePlaylistNames = append(uniquePlaylistNames, key)
-	}
 	utils.GetLoggingService().Debug("... indexing done")
-	return uniquePlaylistNames, nil
+	return true, nil
 }
 
-func (syncService *SynchronizationService) gatherSubscriptionNewVideos(pipedSubscription pipedDto.SubscriptionDto, subscriptionChannelRepository *channelDb.SQLiteChannelRepository) (*[]pipedVideoDto.StreamDto, error) {
+// gatherSubscriptionNewVideos returns the new videos of a subscription, from the newest to the oldest, along with the
+// ones not published yet and its channel as persisted in database.
+//
+// The channel cursor is not moved: see persistChannelVideos.
+func (syncService *SynchronizationService) gatherSubscriptionNewVideos(ctx context.Context, pipedSubscription pipedDto.SubscriptionDto, subscriptionChannelRepository *channelDb.SQLiteChannelRepository, videoRepository *videoDb.SQLiteVideoRepository) (*[]pipedVideoDto.StreamDto, []pipedVideoDto.RelatedStreamDto, *channelDb.SubscriptionChannel, error) {
 	utils.GetLoggingService().Debug(fmt.Sprintf("Fetching subscription channel '%s'", pipedSubscription.Name))
 	configuration := config.GetConfigurationServiceInstance().Configuration
-	pipedChannel, err := pipedApi.FetchChannel(pipedSubscription, configuration.Instance)
+	pipedChannel, err := syncService.pipedClient.FetchChannel(ctx, pipedSubscription)
 	if err != nil {
-		return nil, utils.WrapError(fmt.Sprintf("unable to retrieve the channel '%s'", pipedSubscription.Name), err)
+		return nil, nil, nil, utils.WrapError(fmt.Sprintf("unable to retrieve the channel '%s'", pipedSubscription.Name), err)
 	}
 
 	// find the channel in db (create it if needed)
@@ -217,48 +612,392 @@ func (syncService *SynchronizationService) gatherSubscriptionNewVideos(pipedSubs
 		if errors.Is(err, dbCommon.ErrNotExists) {
 			utils.GetLoggingService().Debug("... channel not found, creating it...")
 			subscriptionChannel, err = subscriptionChannelRepository.Create(channelDb.SubscriptionChannel{
-				Id:            pipedChannel.Id,
-				LastVideoDate: "2000-01-01",
+				Id:           pipedChannel.Id,
+				Name:         pipedSubscription.Name,
+				LastUploaded: 0,
 			})
 			if err != nil {
-				return nil, utils.WrapError(fmt.Sprintf("unable to create the channel in database: '%s'", pipedSubscription.Name), err)
+				return nil, nil, nil, utils.WrapError(fmt.Sprintf("unable to create the channel in database: '%s'", pipedSubscription.Name), err)
 			}
 		} else {
-			return nil, utils.WrapError(fmt.Sprintf("unexpected error when fetching the channel from database: '%s'", pipedSubscription.Name), err)
+			return nil, nil, nil, utils.WrapError(fmt.Sprintf("unexpected error when fetching the channel from database: '%s'", pipedSubscription.Name), err)
 		}
 	} else {
 		utils.GetLoggingService().Debug("... channel found")
 	}
 
 	// determine the start date according to the sync conf and the channel info
-	startDate, err := syncService.determineStartDateForChannel(subscriptionChannel, &configuration)
+	startDate := syncService.determineStartDateForChannel(subscriptionChannel, &configuration)
+
+	utils.GetLoggingService().Debug(fmt.Sprintf("Fetching videos since %s", startDate))
+	// the listing dates are enough, as long as they don't straddle two buckets of any strategy the videos may follow,
+	// and the category is not needed by the rules
+	strategies := []string{syncService.determineStrategyForChannel(pipedChannel.Id)}
+	for _, rule := range configuration.Synchronization.Rules {
+		strategies = append(strategies, rule.Strategy)
+	}
+	if strings.EqualFold(syncService.determineShortsPolicyForChannel(pipedChannel.Id), model.ShortsSeparate) {
+		strategies = append(strategies, configuration.Synchronization.Strategy)
+	}
+	isAmbiguous := func(earliest time.Time, latest time.Time) bool {
+		if syncService.rulesEngine.UsesCategories() {
+			return true
+		}
+		for _, strategy := range strategies {
+			if strings.EqualFold(strategy, model.PlaylistChannelStrategy) {
+				continue
+			}
+			if syncService.calendar.ForDate(earliest, strategy).Id != syncService.calendar.ForDate(latest, strategy).Id {
+				return true
+			}
+		}
+		return false
+	}
+	// the videos of the overlap window are already known
+	isKnown := func(videoId string) bool {
+		exist, err := videoRepository.Exists(videoId)
+		return err == nil && exist
+	}
+	var upcomingStreams []pipedVideoDto.RelatedStreamDto
+	onUpcoming := func(relatedStream pipedVideoDto.RelatedStreamDto) {
+		upcomingStreams = append(upcomingStreams, relatedStream)
+	}
+	videos, err := syncService.pipedClient.FetchChannelVideos(ctx, pipedChannel, startDate, syncService.calendar.Location(), isAmbiguous, isKnown, onUpcoming)
 	if err != nil {
-		return nil, utils.WrapError(fmt.Sprintf("unable to determine the start date for channel '%s'", pipedSubscription.Name), err)
+		return nil, nil, nil, utils.WrapError(fmt.Sprintf("unable to retrieve the videos for channel '%s'", pipedSubscription.Name), err)
 	}
+	utils.GetLoggingService().Debug(fmt.Sprintf("... %v found, %v not published yet", len(*videos), len(upcomingStreams)))
 
-	utils.GetLoggingService().Debug(fmt.Sprintf("Fetching videos since %s", startDate))
-	videos, err := pipedApi.FetchChannelVideos(pipedChannel, startDate, configuration.Instance)
+	return videos, upcomingStreams, subscriptionChannel, nil
+}
+
+// persistChannelVideos creates the new videos of a channel, marks their playlists as dirty, records the videos not
+// published yet and moves the channel cursor, in a single transaction: on failure, the database is left as if the
+// channel had not been processed.
+//
+// The number of created videos is returned.
+func (syncService *SynchronizationService) persistChannelVideos(channelId string, pipedSubscription pipedDto.SubscriptionDto, subscriptionChannel *channelDb.SubscriptionChannel, newPipedVideos *[]pipedVideoDto.StreamDto, upcomingStreams []pipedVideoDto.RelatedStreamDto, syncRun *runDb.SyncRun, subscriptionChannelRepository *channelDb.SQLiteChannelRepository, videoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, metadataRepository *metadataDb.SQLiteMetadataRepository, upcomingRepository *upcomingDb.SQLiteUpcomingVideoRepository) (int, error) {
+	playlistStrategy := syncService.determineStrategyForChannel(channelId)
+	tx, err := db.GetDatabaseServiceInstance().Begin()
+	if err != nil {
+		return 0, utils.WrapError(fmt.Sprintf("Can't start a transaction for the channel '%s'", pipedSubscription.Name), err)
+	}
+	defer tx.Rollback()
+
+	newVideosCount := 0
+	for _, newPipedVideo := range *newPipedVideos {
+		// try to add the video into db is not already present
+		videoId := pipedApi.ExtractVideoIdFromUrl(newPipedVideo.Url)
+		exist, err := videoRepository.ExistsTx(tx, videoId)
+		if err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Can't read the video from database '%s'", videoId), err)
+		}
+		if exist {
+			continue
+		}
+		videoBuckets, err := syncService.determineBucketsForVideo(newPipedVideo, channelId, playlistStrategy)
+		if err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Unable to determine the playlist for the video '%s'", newPipedVideo.Url), err)
+		}
+		_, err = metadataRepository.SaveTx(tx, toVideoMetadata(newPipedVideo, channelId, pipedSubscription.Name))
+		if err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Can't save the metadata of the video in database '%s'", videoId), err)
+		}
+		if err := syncService.fileVideoTx(tx, videoId, newPipedVideo, videoBuckets, syncRun, videoRepository, syncRunRepository, upcomingRepository); err != nil {
+			return 0, err
+		}
+		newVideosCount = newVideosCount + 1
+	}
+
+	// the videos not published yet are checked again by the next synchronizations
+	now := time.Now().UnixMilli()
+	for _, upcomingStream := range upcomingStreams {
+		videoId := pipedApi.ExtractVideoIdFromUrl(upcomingStream.Url)
+		exist, err := videoRepository.ExistsTx(tx, videoId)
+		if err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Can't read the video from database '%s'", videoId), err)
+		}
+		if exist {
+			continue
+		}
+		scheduled := upcomingStream.Uploaded
+		if scheduled < now {
+			scheduled = now
+		}
+		_, err = upcomingRepository.SaveTx(tx, upcomingDb.UpcomingVideo{
+			Id:         videoId,
+			ChannelId:  channelId,
+			Scheduled:  scheduled,
+			Livestream: upcomingStream.Duration < 0,
+		})
+		if err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Can't record the upcoming video in database '%s'", videoId), err)
+		}
+	}
+
+	// move the channel cursor to the newest video seen
+	lastUploaded := subscriptionChannel.LastUploaded
+	for _, newPipedVideo := range *newPipedVideos {
+		if uploaded := syncService.uploadedTime(newPipedVideo); uploaded > lastUploaded {
+			lastUploaded = uploaded
+		}
+	}
+	if lastUploaded != subscriptionChannel.LastUploaded {
+		if syncService.plan != nil {
+			syncService.plan.ChannelCursorMoves = append(syncService.plan.ChannelCursorMoves, ChannelCursorMove{
+				Channel: pipedSubscription.Name,
+				From:    formatCursor(subscriptionChannel.LastUploaded),
+				To:      formatCursor(lastUploaded),
+			})
+		}
+		subscriptionChannel.LastUploaded = lastUploaded
+		if _, err := subscriptionChannelRepository.UpdateTx(tx, subscriptionChannel.Id, *subscriptionChannel); err != nil {
+			return 0, utils.WrapError(fmt.Sprintf("Unable to update the channel in database: '%s'", pipedSubscription.Name), err)
+		}
+	}
+	err = syncRunRepository.SetChannelIndexedTx(tx, syncRun.Id, channelId)
+	if err != nil {
+		return 0, utils.WrapError(fmt.Sprintf("Can't mark the channel as indexed in database '%s'", pipedSubscription.Name), err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, utils.WrapError(fmt.Sprintf("Can't save the videos of the channel '%s' in database", pipedSubscription.Name), err)
+	}
+	return newVideosCount, nil
+}
+
+// fileVideoTx creates a video into each of its buckets and marks their playlists as dirty, the video being no longer
+// upcoming. The ignored videos are recorded as removed, so that they are never processed again.
+func (syncService *SynchronizationService) fileVideoTx(tx *sql.Tx, videoId string, pipedVideo pipedVideoDto.StreamDto, videoBuckets []bucket.Bucket, syncRun *runDb.SyncRun, videoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, upcomingRepository *upcomingDb.SQLiteUpcomingVideoRepository) error {
+	for _, videoBucket := range videoBuckets {
+		removed := 0
+		if videoBucket.IsIgnored() {
+			removed = 1
+		}
+		_, err := videoRepository.CreateTx(tx, videoDb.SubscriptionVideo{
+			Id:         videoId,
+			UploadDate: pipedVideo.UploadDate,
+			Uploaded:   pipedVideo.Uploaded,
+			Removed:    removed,
+			Bucket:     videoBucket.Id,
+		})
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("Can't create the video in database '%s'", videoId), err)
+		}
+		if videoBucket.IsIgnored() {
+			continue
+		}
+		err = syncRunRepository.SetBucketDirtyTx(tx, syncRun.Id, videoBucket.Id)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("Can't mark the playlist as dirty in database '%s'", videoBucket.Id), err)
+		}
+	}
+	if err := upcomingRepository.DeleteTx(tx, videoId); err != nil {
+		return utils.WrapError(fmt.Sprintf("Can't delete the upcoming video from database '%s'", videoId), err)
+	}
+	return nil
+}
+
+// upcomingVideoExpiry is the time after which an upcoming video still not published is given up, like a cancelled
+// premiere.
+const upcomingVideoExpiry = 30 * 24 * time.Hour
+
+// checkUpcomingVideos fetches the details of the videos not published yet, and files the published ones.
+//
+// A livestream is only published once over, as a VOD. The videos still not published long after their expected
+// publication are given up.
+func (syncService *SynchronizationService) checkUpcomingVideos(ctx context.Context, syncRun *runDb.SyncRun, videoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, metadataRepository *metadataDb.SQLiteMetadataRepository, upcomingRepository *upcomingDb.SQLiteUpcomingVideoRepository) error {
+	upcomingVideos, err := upcomingRepository.GetAll()
 	if err != nil {
-		return nil, utils.WrapError(fmt.Sprintf("unable to retrieve the videos for channel '%s'", pipedSubscription.Name), err)
+		return utils.WrapError("unable to read the upcoming videos from database", err)
+	}
+	if len(*upcomingVideos) == 0 {
+		return nil
+	}
+	utils.GetLoggingService().Debug(fmt.Sprintf("Checking %d upcoming videos", len(*upcomingVideos)))
+	videoIds := make([]string, len(*upcomingVideos))
+	for i, upcomingVideo := range *upcomingVideos {
+		videoIds[i] = upcomingVideo.Id
+	}
+	// the details of the videos not published yet are usually unavailable
+	pipedVideos := syncService.pipedClient.FetchVideos(ctx, videoIds)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.GetDatabaseServiceInstance().Begin()
+	if err != nil {
+		return utils.WrapError("can't start a transaction to file the upcoming videos", err)
+	}
+	defer tx.Rollback()
+	publishedCount := 0
+	for i, upcomingVideo := range *upcomingVideos {
+		pipedVideo := pipedVideos[i]
+		// the video may have been indexed from the listing of its channel meanwhile
+		exist, err := videoRepository.ExistsTx(tx, upcomingVideo.Id)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("can't read the video from database '%s'", upcomingVideo.Id), err)
+		}
+		if exist {
+			if err := upcomingRepository.DeleteTx(tx, upcomingVideo.Id); err != nil {
+				return utils.WrapError(fmt.Sprintf("can't delete the upcoming video from database '%s'", upcomingVideo.Id), err)
+			}
+			continue
+		}
+		if pipedVideo == nil || pipedVideo.Views < 0 || pipedVideo.Livestream {
+			if pipedVideo != nil && pipedVideo.Livestream && !upcomingVideo.Livestream {
+				upcomingVideo.Livestream = true
+				if _, err := upcomingRepository.SaveTx(tx, upcomingVideo); err != nil {
+					return utils.WrapError(fmt.Sprintf("can't update the upcoming video in database '%s'", upcomingVideo.Id), err)
+				}
+			}
+			if time.Now().After(time.UnixMilli(upcomingVideo.Scheduled).Add(upcomingVideoExpiry)) {
+				utils.GetLoggingService().Debug(fmt.Sprintf("Giving up the upcoming video '%s'", upcomingVideo.Id))
+				if err := upcomingRepository.DeleteTx(tx, upcomingVideo.Id); err != nil {
+					return utils.WrapError(fmt.Sprintf("can't delete the upcoming video from database '%s'", upcomingVideo.Id), err)
+				}
+			}
+			continue
+		}
+
+		pipedVideo.Livestream = upcomingVideo.Livestream
+		videoBuckets, err := syncService.determineBucketsForVideo(*pipedVideo, upcomingVideo.ChannelId, syncService.determineStrategyForChannel(upcomingVideo.ChannelId))
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to determine the playlist for the video '%s'", upcomingVideo.Id), err)
+		}
+		_, err = metadataRepository.SaveTx(tx, toVideoMetadata(*pipedVideo, upcomingVideo.ChannelId, ""))
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("can't save the metadata of the video in database '%s'", upcomingVideo.Id), err)
+		}
+		if err := syncService.fileVideoTx(tx, upcomingVideo.Id, *pipedVideo, videoBuckets, syncRun, videoRepository, syncRunRepository, upcomingRepository); err != nil {
+			return err
+		}
+		publishedCount++
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.WrapError("can't save the upcoming videos in database", err)
+	}
+	utils.GetLoggingService().Debug(fmt.Sprintf("... %d published", publishedCount))
+	return nil
+}
+
+// applyBudget moves the videos exceeding the watch-time budget of the dirty period playlists to the playlist of the next
+// period or to the overflow playlist, both being marked as dirty.
+//
+// The videos of the channels with the highest priority fill the playlists first, then the newest ones. A video longer
+// than the budget is kept all the same if its playlist is empty otherwise, and the playlists of the rules are not
+// budgeted.
+func (syncService *SynchronizationService) applyBudget(syncRun *runDb.SyncRun, videoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository) error {
+	budget := config.GetConfigurationServiceInstance().Configuration.Synchronization.Budget
+	if budget.Hours == 0 {
+		return nil
+	}
+	dirtyBuckets, err := syncRunRepository.GetDirtyBuckets(syncRun.Id)
+	if err != nil {
+		return utils.WrapError("unable to read the playlists to update from the database", err)
+	}
+	pendingBuckets := make(map[string]bucket.Bucket)
+	for _, bucketId := range *dirtyBuckets {
+		if dirtyBucket := syncService.calendar.Parse(bucketId); syncService.isBudgeted(dirtyBucket) {
+			pendingBuckets[bucketId] = dirtyBucket
+		}
+	}
+
+	tx, err := db.GetDatabaseServiceInstance().Begin()
+	if err != nil {
+		return utils.WrapError("can't start a transaction to move the videos", err)
+	}
+	defer tx.Rollback()
+	budgetSeconds := int64(budget.Hours) * 3600
+	movedCount := 0
+	for len(pendingBuckets) > 0 {
+		// the earliest period first, so that the videos carried over to the next one are taken into account
+		var periodBucket bucket.Bucket
+		for _, pendingBucket := range pendingBuckets {
+			if periodBucket.Id == "" || pendingBucket.Start.Before(periodBucket.Start) || (pendingBucket.Start.Equal(periodBucket.Start) && pendingBucket.Id < periodBucket.Id) {
+				periodBucket = pendingBucket
+			}
+		}
+		delete(pendingBuckets, periodBucket.Id)
+
+		videos, err := videoRepository.GetTimedByBucketTx(tx, periodBucket.Id)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("unable to read the videos of the playlist from database '%s'", periodBucket.Id), err)
+		}
+		sort.SliceStable(*videos, func(i, j int) bool {
+			return syncService.determineChannelPriority((*videos)[i].ChannelId) < syncService.determineChannelPriority((*videos)[j].ChannelId)
+		})
+		var totalSeconds int64
+		keptCount := 0
+		for _, video := range *videos {
+			if keptCount == 0 || totalSeconds+video.Duration <= budgetSeconds {
+				totalSeconds += video.Duration
+				keptCount++
+				continue
+			}
+			overflowBucket := bucket.Overflow().InGroup(periodBucket.Group)
+			if syncService.carriesOverBudget(periodBucket) {
+				overflowBucket = syncService.calendar.Next(periodBucket)
+				pendingBuckets[overflowBucket.Id] = overflowBucket
+			}
+			utils.GetLoggingService().Debug(fmt.Sprintf("Moving the video '%s' exceeding the budget from '%s' to '%s'", video.Id, video.Bucket, overflowBucket.Id))
+			formerBucketId := video.Bucket
+			video.Bucket = overflowBucket.Id
+			if _, err := videoRepository.UpdateTx(tx, video.Id, formerBucketId, video.SubscriptionVideo); err != nil {
+				return utils.WrapError(fmt.Sprintf("can't move the video in database '%s'", video.Id), err)
+			}
+			if err := syncRunRepository.SetBucketDirtyTx(tx, syncRun.Id, overflowBucket.Id); err != nil {
+				return utils.WrapError(fmt.Sprintf("can't mark the playlist as dirty in database '%s'", overflowBucket.Id), err)
+			}
+			movedCount++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.WrapError("can't save the moved videos in database", err)
 	}
-	utils.GetLoggingService().Debug(fmt.Sprintf("... %v found", len(*videos)))
+	utils.GetLoggingService().Debug(fmt.Sprintf("%d videos exceeding the budget moved", movedCount))
+	return nil
+}
 
-	// update the persisted channel video date
-	if len(*videos) != 0 {
-		subscriptionChannel.LastVideoDate = (*videos)[0].UploadDate
-		if _, err := subscriptionChannelRepository.Update(subscriptionChannel.Id, *subscriptionChannel); err != nil {
-			return nil, utils.WrapError(fmt.Sprintf("Unable to update the channel in database: '%s'", pipedSubscription.Name), err)
+// isBudgeted tells if the watch-time budget applies to the playlist of a bucket: a period playlist not belonging to a
+// rule.
+func (syncService *SynchronizationService) isBudgeted(playlistBucket bucket.Bucket) bool {
+	if !playlistBucket.IsPeriod() {
+		return false
+	}
+	for _, rule := range config.GetConfigurationServiceInstance().Configuration.Synchronization.Rules {
+		if rule.Name == playlistBucket.Group {
+			return false
 		}
 	}
-	return videos, nil
+	return true
+}
+
+// carriesOverBudget tells if the videos exceeding the budget of the playlist of a bucket go to the playlist of the next
+// period.
+func (syncService *SynchronizationService) carriesOverBudget(playlistBucket bucket.Bucket) bool {
+	budget := config.GetConfigurationServiceInstance().Configuration.Synchronization.Budget
+	return budget.Hours != 0 && strings.EqualFold(budget.Overflow, model.BudgetOverflowNext) && syncService.isBudgeted(playlistBucket)
 }
 
-func (syncService *SynchronizationService) determineStartDateForChannel(subscriptionChannel *channelDb.SubscriptionChannel, configuration *model.Configuration) (time.Time, error) {
+// determineChannelPriority returns the rank of a channel in the priorities of the budget, the channels not listed
+// coming last.
+func (syncService *SynchronizationService) determineChannelPriority(channelId string) int {
+	if rank, present := syncService.channelPriorities[channelId]; present {
+		return rank
+	}
+	return len(config.GetConfigurationServiceInstance().Configuration.Synchronization.Budget.ChannelPriorities)
+}
+
+// determineStartDateForChannel returns the time from which the videos of a channel are browsed.
+//
+// Once the channel has been indexed, its cursor minus the overlap window is used, unless the configuration starts later.
+func (syncService *SynchronizationService) determineStartDateForChannel(subscriptionChannel *channelDb.SubscriptionChannel, configuration *model.Configuration) time.Time {
 	// get the start date as defined from the configuration
 	var startDateForConf time.Time
+	location := syncService.calendar.Location()
 	if strings.EqualFold(configuration.Synchronization.Type, model.SyncDurationType) {
-		now := time.Now()
-		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		now := time.Now().In(location)
+		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
 		switch configuration.Synchronization.Duration.Unit {
 		case model.SyncDurationUnitMonth:
 			startDateForConf = startOfDay.AddDate(0, int(-configuration.Synchronization.Duration.Value), 0)
@@ -267,97 +1006,495 @@ func (syncService *SynchronizationService) determineStartDateForChannel(subscrip
 		}
 	} else {
 		// it assumes that the date has already been checked at startup
-		startDateForConf, _ = time.Parse("2006-01-02", configuration.Synchronization.Date)
+		startDateForConf, _ = syncService.calendar.ParseDay(configuration.Synchronization.Date)
+	}
+	if subscriptionChannel.LastUploaded <= 0 {
+		return startDateForConf
+	}
+
+	// get the max between the configuration date and the channel cursor
+	overlap := time.Duration(configuration.Synchronization.OverlapHours) * time.Hour
+	startDateForChannel := time.UnixMilli(subscriptionChannel.LastUploaded).UTC().Add(-overlap)
+	if startDateForConf.After(startDateForChannel) {
+		return startDateForConf
 	}
+	return startDateForChannel
+}
 
-	// get the max between the configuration date and the last video date of the channel
-	startDateForChannel, err := time.Parse("2006-01-02", subscriptionChannel.LastVideoDate)
+// uploadedTime returns the upload time of a video in milliseconds, as precise as provided by the Piped instance.
+//
+// A video only known by its upload day is considered uploaded at the start of this day, in the time zone of the
+// calendar.
+func (syncService *SynchronizationService) uploadedTime(pipedVideo pipedVideoDto.StreamDto) int64 {
+	if pipedVideo.Uploaded > 0 {
+		return pipedVideo.Uploaded
+	}
+	uploadDate, err := syncService.calendar.ParseDay(pipedVideo.UploadDate)
 	if err != nil {
-		return time.Now(), err
+		return 0
 	}
-	var startDate time.Time
-	if startDateForConf.After(startDateForChannel) {
-		startDate = startDateForConf
-	} else {
-		startDate = startDateForChannel
+	return uploadDate.UnixMilli()
+}
+
+func formatCursor(uploaded int64) string {
+	if uploaded <= 0 {
+		return "never"
 	}
-	return startDate, nil
+	return time.UnixMilli(uploaded).UTC().Format(time.RFC3339)
 }
 
-func (syncService *SynchronizationService) syncPipedPlaylistsFromDb(playlistNames []string, subscriptionVideoRepository *videoDb.SQLiteVideoRepository) error {
+func (syncService *SynchronizationService) syncPipedPlaylistsFromDb(ctx context.Context, bucketIds []string, syncRun *runDb.SyncRun, subscriptionVideoRepository *videoDb.SQLiteVideoRepository, syncRunRepository *runDb.SQLiteSyncRunRepository, playlistRepository *playlistDb.SQLitePlaylistRepository, subscriptionChannelRepository *channelDb.SQLiteChannelRepository) error {
 	// retrieve the playlists to be updated
 	utils.GetLoggingService().Debug("Populating playlists...")
 	utils.GetLoggingService().ConsoleProgress("[5/5] Populating playlists...")
-	pipedPlaylists, err := syncService.fetchPlaylistsMap()
+	pipedPlaylists, err := syncService.fetchPlaylistsMap(ctx, playlistRepository)
 	if err != nil {
 		return err
 	}
-	for _, playlistName := range playlistNames {
+	channelOrder := config.GetConfigurationServiceInstance().Configuration.Synchronization.ChannelOrder
+	for _, bucketId := range bucketIds {
+		playlistBucket := syncService.calendar.Parse(bucketId)
+		playlistName, err := syncService.nameBucket(playlistBucket, subscriptionChannelRepository)
+		if err != nil {
+			return err
+		}
 		utils.GetLoggingService().Debug(fmt.Sprintf("%s", playlistName))
-		pipedPlaylist, playlistPresent := (*pipedPlaylists)[playlistName]
-		var playlistId string
+		pipedPlaylist, playlistPresent := (*pipedPlaylists)[bucketId]
+
+		// compare the current content of the playlist with the expected one
+		var currentVideoIds []string
+		if playlistPresent {
+			pipedVideosMeta, err := syncService.pipedClient.FetchPlaylistVideos(ctx, pipedPlaylist.Id)
+			if err != nil {
+				return utils.WrapError(fmt.Sprintf("can't read the existing playlist '%s'", playlistName), err)
+			}
+			for _, pipedVideoMeta := range *pipedVideosMeta {
+				currentVideoIds = append(currentVideoIds, pipedApi.ExtractVideoIdFromUrl(pipedVideoMeta.Url))
+			}
+		}
+		// the period playlists left without any video, like the ones emptied by a rebucket, are deleted
+		if playlistBucket.IsPeriod() {
+			count, err := subscriptionVideoRepository.CountByBucket(bucketId)
+			if err != nil {
+				return utils.WrapError(fmt.Sprintf("can't count the videos of the playlist in database '%s'", playlistName), err)
+			}
+			if count == 0 {
+				if err := syncService.deletePlaylist(ctx, playlistName, bucketId, pipedPlaylist, playlistPresent, syncRun, syncRunRepository, playlistRepository); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		videos, err := subscriptionVideoRepository.GetByBucket(bucketId)
+		if err != nil {
+			return utils.WrapError(fmt.Sprintf("can't read the playlist from database '%s'", playlistName), err)
+		}
+		rollingWindowStart := syncService.determineRollingWindowStart()
+		var expectedVideoIds []string
+		for _, video := range *videos {
+			if playlistBucket.Strategy == bucket.StrategyRolling && syncService.isBeforeDay(video, rollingWindowStart) {
+				continue
+			}
+			expectedVideoIds = append(expectedVideoIds, video.Id)
+		}
+		// the order of the playlists dedicated to a channel is kept, even if they have to be rebuilt
+		var diff PlaylistDiff
+		if playlistBucket.Strategy == bucket.StrategyChannel {
+			if strings.EqualFold(channelOrder, model.ChannelOrderOldest) {
+				reverse(expectedVideoIds)
+			}
+			diff = computeOrderedPlaylistDiff(currentVideoIds, expectedVideoIds)
+		} else {
+			diff = computePlaylistDiff(currentVideoIds, expectedVideoIds)
+		}
+		utils.GetLoggingService().Debug(fmt.Sprintf("... %d videos to add, %d to remove", len(diff.AddedVideoIds), len(diff.RemovedIndexes)))
+
+		if syncService.plan != nil {
+			if !playlistPresent {
+				syncService.plan.PlaylistsToCreate = append(syncService.plan.PlaylistsToCreate, playlistName)
+			}
+			syncService.plan.addPlaylistDiff(playlistName, diff)
+			continue
+		}
+		if playlistPresent && diff.isEmpty() {
+			if err := syncRunRepository.SetBucketPushed(syncRun.Id, bucketId); err != nil {
+				return utils.WrapError(fmt.Sprintf("can't mark the playlist as pushed in database '%s'", playlistName), err)
+			}
+			continue
+		}
+
+		// create the playlist if missing, and remember it right away so that it is found again whatever its name
+		playlistId := pipedPlaylist.Id
 		if !playlistPresent {
-			// create the playlist if missing
-			playlist, err := pipedApi.CreatePlaylist(playlistName, config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+			playlist, err := syncService.pipedClient.CreatePlaylist(ctx, playlistName)
 			if err != nil {
 				return utils.WrapError("can't create playlist in the piped instance", err)
 			}
 			playlistId = playlist.PlaylistId
-		} else {
-			// clear the existing playlist
-			err := pipedApi.ClearPlaylistVideos(pipedPlaylist.Id, config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+			_, err = playlistRepository.Save(playlistDb.ManagedPlaylist{
+				Bucket:     bucketId,
+				PlaylistId: playlistId,
+				Name:       playlistName,
+			})
 			if err != nil {
-				return utils.WrapError("can't clear the existing playlist", err)
+				return utils.WrapError(fmt.Sprintf("can't save the playlist in database '%s'", playlistName), err)
 			}
-			playlistId = pipedPlaylist.Id
 		}
 
-		// populate the playlist with its videos
-		videos, err := subscriptionVideoRepository.GetByPlaylist(playlistName)
+		// add before removing, so that the kept videos never disappear even if a call fails
+		progressBar := utils.CreateProgressBar(len(diff.AddedVideoIds)+len(diff.RemovedIndexes), fmt.Sprintf("'%s'", playlistName))
+		if diff.Rebuild {
+			utils.GetLoggingService().Debug(fmt.Sprintf("... rebuilding the playlist '%s' to keep its order", playlistName))
+		}
+		if len(diff.AddedVideoIds) != 0 {
+			err = syncService.pipedClient.AddVideosIntoPlaylist(ctx, playlistId, &diff.AddedVideoIds)
+			if err != nil {
+				return utils.WrapError(fmt.Sprintf("can't insert videos into playlist '%s'", playlistName), err)
+			}
+			for range diff.AddedVideoIds {
+				utils.IncrementProgressBar(progressBar)
+			}
+		}
+		for _, index := range diff.RemovedIndexes {
+			err = syncService.pipedClient.RemoveVideoFromPlaylist(ctx, playlistId, index)
+			if err != nil {
+				return utils.WrapError(fmt.Sprintf("can't remove a video from playlist '%s'", playlistName), err)
+			}
+			utils.IncrementProgressBar(progressBar)
+		}
+		utils.FinalizeProgressBar(progressBar, len(diff.AddedVideoIds)+len(diff.RemovedIndexes))
+		if err := syncRunRepository.SetBucketPushed(syncRun.Id, bucketId); err != nil {
+			return utils.WrapError(fmt.Sprintf("can't mark the playlist as pushed in database '%s'", playlistName), err)
+		}
+	}
+	utils.GetLoggingService().Debug("... populating done")
+	return nil
+}
+
+// deletePlaylist deletes the playlist of a bucket which doesn't hold any video anymore, and forgets it.
+func (syncService *SynchronizationService) deletePlaylist(ctx context.Context, playlistName string, bucketId string, pipedPlaylist pipedPlaylistDto.PlaylistDto, playlistPresent bool, syncRun *runDb.SyncRun, syncRunRepository *runDb.SQLiteSyncRunRepository, playlistRepository *playlistDb.SQLitePlaylistRepository) error {
+	if syncService.plan != nil {
+		if playlistPresent {
+			syncService.plan.PlaylistsToDelete = append(syncService.plan.PlaylistsToDelete, playlistName)
+		}
+		return nil
+	}
+	if playlistPresent {
+		utils.GetLoggingService().Info(fmt.Sprintf("Deleting the empty playlist '%s'", playlistName))
+		if err := syncService.pipedClient.DeletePlaylist(ctx, pipedPlaylist.Id); err != nil {
+			return utils.WrapError(fmt.Sprintf("can't delete the playlist '%s'", playlistName), err)
+		}
+		if err := playlistRepository.Delete(bucketId); err != nil {
+			return utils.WrapError(fmt.Sprintf("can't forget the playlist in database '%s'", playlistName), err)
+		}
+	}
+	if err := syncRunRepository.SetBucketPushed(syncRun.Id, bucketId); err != nil {
+		return utils.WrapError(fmt.Sprintf("can't mark the playlist as pushed in database '%s'", playlistName), err)
+	}
+	return nil
+}
+
+// renamePlaylists renames the playlists whose name doesn't match the configured template anymore.
+func (syncService *SynchronizationService) renamePlaylists(ctx context.Context, pipedPlaylists *map[string]pipedPlaylistDto.PlaylistDto, playlistRepository *playlistDb.SQLitePlaylistRepository, subscriptionChannelRepository *channelDb.SQLiteChannelRepository) error {
+	var bucketIds []string
+	for bucketId := range *pipedPlaylists {
+		bucketIds = append(bucketIds, bucketId)
+	}
+	sort.Strings(bucketIds)
+	for _, bucketId := range bucketIds {
+		pipedPlaylist := (*pipedPlaylists)[bucketId]
+		playlistName, err := syncService.nameBucket(syncService.calendar.Parse(bucketId), subscriptionChannelRepository)
 		if err != nil {
-			return utils.WrapError(fmt.Sprintf("can't read the playlist from database '%s'", playlistName), err)
+			return err
 		}
-		progressBar := utils.CreateProgressBar(len(*videos), fmt.Sprintf("'%s'", playlistName))
-		var pipedVideoIds []string
-		for _, video := range *videos {
-			pipedVideoIds = append(pipedVideoIds, video.Id)
+		if playlistName == pipedPlaylist.Name {
+			continue
 		}
-		err = pipedApi.AddVideosIntoPlaylist(playlistId, &pipedVideoIds, config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+		utils.GetLoggingService().Info(fmt.Sprintf("Renaming the playlist '%s' into '%s'", pipedPlaylist.Name, playlistName))
+		if syncService.plan != nil {
+			syncService.plan.PlaylistRenames = append(syncService.plan.PlaylistRenames, PlaylistRename{
+				From: pipedPlaylist.Name,
+				To:   playlistName,
+			})
+			continue
+		}
+		if err := syncService.pipedClient.RenamePlaylist(ctx, pipedPlaylist.Id, playlistName); err != nil {
+			return utils.WrapError(fmt.Sprintf("can't rename the playlist '%s'", pipedPlaylist.Name), err)
+		}
+		_, err = playlistRepository.Save(playlistDb.ManagedPlaylist{
+			Bucket:     bucketId,
+			PlaylistId: pipedPlaylist.Id,
+			Name:       playlistName,
+		})
 		if err != nil {
-			return utils.WrapError(fmt.Sprintf("can't insert videos into playlist '%s'", playlistName), err)
+			return utils.WrapError(fmt.Sprintf("can't save the playlist in database '%s'", playlistName), err)
 		}
-		utils.FinalizeProgressBar(progressBar, len(*videos))
+		pipedPlaylist.Name = playlistName
+		(*pipedPlaylists)[bucketId] = pipedPlaylist
 	}
-	utils.GetLoggingService().Debug("... populating done")
 	return nil
 }
 
-func (syncService *SynchronizationService) determinePlaylistForVideo(pipedVideo pipedVideoDto.StreamDto, prefix string, playlistCreationStrategy string) (string, error) {
-	videoDate, err := time.Parse("2006-01-02", pipedVideo.UploadDate)
+// nameBucket returns the name of the playlist of a bucket, the playlists dedicated to a channel being named after the
+// last known name of the channel.
+func (syncService *SynchronizationService) nameBucket(playlistBucket bucket.Bucket, subscriptionChannelRepository *channelDb.SQLiteChannelRepository) (string, error) {
+	if playlistBucket.Strategy == bucket.StrategyChannel {
+		playlistBucket.Channel = playlistBucket.ChannelId
+		subscriptionChannel, err := subscriptionChannelRepository.GetById(playlistBucket.ChannelId)
+		if err == nil && subscriptionChannel.Name != "" {
+			playlistBucket.Channel = subscriptionChannel.Name
+		} else if err != nil && !errors.Is(err, dbCommon.ErrNotExists) {
+			return "", utils.WrapError(fmt.Sprintf("can't read the channel from database '%s'", playlistBucket.ChannelId), err)
+		}
+	}
+	// the playlists of a group removed from the configuration keep being named after the group
+	namer, present := syncService.namers[playlistBucket.Group]
+	if !present {
+		synchronization := config.GetConfigurationServiceInstance().Configuration.Synchronization
+		var err error
+		namer, err = bucket.NewNamer(model.DefaultGroupPlaylistPrefix(playlistBucket.Group), synchronization.NameTemplate, synchronization.Locale, synchronization.RollingDays)
+		if err != nil {
+			return "", err
+		}
+		syncService.namers[playlistBucket.Group] = namer
+	}
+	playlistName, err := namer.Name(playlistBucket)
 	if err != nil {
-		return "", err
+		return "", utils.WrapError(fmt.Sprintf("can't name the playlist of the bucket '%s'", playlistBucket.Id), err)
 	}
-	var strategySuffix string
-	if strings.EqualFold(playlistCreationStrategy, model.PlaylistMonthlyStrategy) {
-		strategySuffix = videoDate.Month().String()
-	} else {
-		_, month := videoDate.ISOWeek()
-		strategySuffix = fmt.Sprintf("Week %v", strconv.Itoa(month))
+	return playlistName, nil
+}
+
+// determineStrategyForChannel returns the strategy applied to the videos of a channel, the one of its group if any.
+func (syncService *SynchronizationService) determineStrategyForChannel(channelId string) string {
+	synchronization := config.GetConfigurationServiceInstance().Configuration.Synchronization
+	for _, dedicatedChannelId := range synchronization.ChannelPlaylists {
+		if dedicatedChannelId == channelId {
+			return model.PlaylistChannelStrategy
+		}
+	}
+	if channelGroup, grouped := syncService.channelGroups[channelId]; grouped {
+		return channelGroup.Strategy
 	}
-	return fmt.Sprintf("%v%v %v", prefix, videoDate.Year(), strategySuffix), nil
+	return synchronization.Strategy
 }
 
-func (syncService *SynchronizationService) fetchPlaylistsMap() (*map[string]pipedPlaylistDto.PlaylistDto, error) {
-	var pipedPlaylistsByName = make(map[string]pipedPlaylistDto.PlaylistDto)
+// determineRollingBuckets returns the buckets of the rolling strategy, one for the default playlists and one by group
+// or rule using this strategy.
+func (syncService *SynchronizationService) determineRollingBuckets() []bucket.Bucket {
+	synchronization := config.GetConfigurationServiceInstance().Configuration.Synchronization
+	var rollingBuckets []bucket.Bucket
+	if strings.EqualFold(synchronization.Strategy, model.PlaylistRollingStrategy) {
+		rollingBuckets = append(rollingBuckets, bucket.Rolling())
+	}
+	for _, channelGroup := range synchronization.ChannelGroups {
+		if strings.EqualFold(channelGroup.Strategy, model.PlaylistRollingStrategy) {
+			rollingBuckets = append(rollingBuckets, bucket.Rolling().InGroup(channelGroup.Name))
+		}
+	}
+	for _, rule := range synchronization.Rules {
+		if strings.EqualFold(rule.Action, model.RuleActionPlaylist) && strings.EqualFold(rule.Strategy, model.PlaylistRollingStrategy) {
+			rollingBuckets = append(rollingBuckets, bucket.Rolling().InGroup(rule.Name))
+		}
+	}
+	if strings.EqualFold(synchronization.Strategy, model.PlaylistRollingStrategy) && syncService.separatesShorts() {
+		rollingBuckets = append(rollingBuckets, bucket.Rolling().InGroup(model.ShortsGroup))
+	}
+	return rollingBuckets
+}
+
+// determineShortsPolicyForChannel returns the policy applied to the shorts of a channel, among 'include', 'exclude'
+// and 'separate'.
+func (syncService *SynchronizationService) determineShortsPolicyForChannel(channelId string) string {
+	if shorts, present := syncService.channelShorts[channelId]; present {
+		return shorts
+	}
+	return config.GetConfigurationServiceInstance().Configuration.Synchronization.Shorts
+}
+
+// separatesShorts tells if the shorts of a channel at least are filed into their own playlists.
+func (syncService *SynchronizationService) separatesShorts() bool {
+	if strings.EqualFold(config.GetConfigurationServiceInstance().Configuration.Synchronization.Shorts, model.ShortsSeparate) {
+		return true
+	}
+	for _, shorts := range syncService.channelShorts {
+		if strings.EqualFold(shorts, model.ShortsSeparate) {
+			return true
+		}
+	}
+	return false
+}
+
+// determineRollingWindowStart returns the first day kept by the rolling strategy.
+func (syncService *SynchronizationService) determineRollingWindowStart() time.Time {
+	rollingDays := config.GetConfigurationServiceInstance().Configuration.Synchronization.RollingDays
+	location := syncService.calendar.Location()
+	now := time.Now().In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location).AddDate(0, 0, -rollingDays)
+}
+
+// isBeforeDay tells if a video has been uploaded before the given day, according to its upload date.
+func (syncService *SynchronizationService) isBeforeDay(video videoDb.SubscriptionVideo, day time.Time) bool {
+	uploadDay, err := syncService.calendar.ParseDay(video.UploadDate)
+	return err == nil && uploadDay.Before(day)
+}
+
+// determineBucketsForVideo returns the buckets of a video: the one of the shorts playlists for a separated short, the
+// ones of the matching rules if any, otherwise the one of the strategy inside the group of its channel if any. The
+// ignored videos, like the excluded shorts, livestreams and durations, get the ignored bucket.
+func (syncService *SynchronizationService) determineBucketsForVideo(pipedVideo pipedVideoDto.StreamDto, channelId string, strategy string) ([]bucket.Bucket, error) {
+	videoDate, err := syncService.calendar.ParseDay(pipedVideo.UploadDate)
+	if err != nil {
+		return nil, err
+	}
+	synchronization := config.GetConfigurationServiceInstance().Configuration.Synchronization
+	if pipedVideo.Livestream && strings.EqualFold(synchronization.Livestreams, model.LivestreamsExclude) {
+		return []bucket.Bucket{bucket.Ignored()}, nil
+	}
+	if pipedVideo.IsShort {
+		switch strings.ToLower(syncService.determineShortsPolicyForChannel(channelId)) {
+		case model.ShortsExclude:
+			return []bucket.Bucket{bucket.Ignored()}, nil
+		case model.ShortsSeparate:
+			return []bucket.Bucket{syncService.determineBucket(videoDate, channelId, synchronization.Strategy, model.ShortsGroup)}, nil
+		}
+	}
+	if syncService.isExcludedByDuration(pipedVideo.Duration, channelId) {
+		return []bucket.Bucket{bucket.Ignored()}, nil
+	}
+	matchedRules, ignored := syncService.rulesEngine.Route(syncService.toRulesVideo(pipedVideo, channelId, videoDate))
+	if ignored {
+		return []bucket.Bucket{bucket.Ignored()}, nil
+	}
+	if len(matchedRules) == 0 {
+		return []bucket.Bucket{syncService.determineBucket(videoDate, channelId, strategy, syncService.channelGroups[channelId].Name)}, nil
+	}
+	var videoBuckets []bucket.Bucket
+	for _, rule := range matchedRules {
+		videoBuckets = append(videoBuckets, syncService.determineBucket(videoDate, channelId, rule.Strategy, rule.Name))
+	}
+	return videoBuckets, nil
+}
+
+// isExcludedByDuration tells if a video of a channel is left out because of its duration, in seconds. The videos whose
+// duration is unknown are kept.
+func (syncService *SynchronizationService) isExcludedByDuration(duration int64, channelId string) bool {
+	durationFilter, present := syncService.channelVideoDurations[channelId]
+	if !present {
+		durationFilter = config.GetConfigurationServiceInstance().Configuration.Synchronization.VideoDuration
+	}
+	if duration <= 0 {
+		return false
+	}
+	return duration < durationFilter.MinDuration || (durationFilter.MaxDuration != 0 && duration > durationFilter.MaxDuration)
+}
+
+// determineBucket returns the bucket of a video uploaded at the given date according to the strategy, inside a group.
+func (syncService *SynchronizationService) determineBucket(videoDate time.Time, channelId string, strategy string, group string) bucket.Bucket {
+	if strings.EqualFold(strategy, model.PlaylistChannelStrategy) {
+		return bucket.ForChannel(channelId).InGroup(group)
+	}
+	return syncService.calendar.ForDate(videoDate, strategy).InGroup(group)
+}
+
+// descriptionSnippetLength is the number of characters of the description kept in the metadata of the videos.
+const descriptionSnippetLength = 200
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// toVideoMetadata returns the metadata of a video, the uploader being used when the video doesn't provide it.
+func toVideoMetadata(pipedVideo pipedVideoDto.StreamDto, uploaderId string, uploader string) metadataDb.VideoMetadata {
+	if pipedVideo.Uploader != "" {
+		uploader = pipedVideo.Uploader
+	}
+	// the description is provided as HTML
+	description := strings.Join(strings.Fields(html.UnescapeString(htmlTagRegexp.ReplaceAllString(pipedVideo.Description, " "))), " ")
+	if runes := []rune(description); len(runes) > descriptionSnippetLength {
+		description = string(runes[:descriptionSnippetLength])
+	}
+	return metadataDb.VideoMetadata{
+		Id:           pipedApi.ExtractVideoIdFromUrl(pipedVideo.Url),
+		Title:        pipedVideo.Title,
+		Uploader:     uploader,
+		UploaderId:   uploaderId,
+		Duration:     pipedVideo.Duration,
+		ThumbnailUrl: pipedVideo.ThumbnailUrl,
+		Category:     pipedVideo.Category,
+		Short:        pipedVideo.IsShort,
+		Livestream:   pipedVideo.Livestream,
+		Views:        pipedVideo.Views,
+		Description:  description,
+		Detailed:     pipedVideo.Detailed,
+	}
+}
+
+// toRulesVideo returns the properties of a video the rules are evaluated against.
+func (syncService *SynchronizationService) toRulesVideo(pipedVideo pipedVideoDto.StreamDto, channelId string, videoDate time.Time) rules.Video {
+	return rules.Video{
+		ChannelId: channelId,
+		Title:     pipedVideo.Title,
+		Duration:  pipedVideo.Duration,
+		Category:  pipedVideo.Category,
+		Weekday:   videoDate.Weekday(),
+	}
+}
+
+// fetchPlaylistsMap returns the playlists of the Piped instance managed by the application, by bucket id.
+//
+// The playlists are found from the buckets stored in database. The playlists created by the former versions, which
+// didn't store them, are found from their name and stored along the way.
+func (syncService *SynchronizationService) fetchPlaylistsMap(ctx context.Context, playlistRepository *playlistDb.SQLitePlaylistRepository) (*map[string]pipedPlaylistDto.PlaylistDto, error) {
+	var pipedPlaylistsByBucket = make(map[string]pipedPlaylistDto.PlaylistDto)
 	prefix := config.GetConfigurationServiceInstance().Configuration.Synchronization.PlaylistPrefix
-	pipedPlaylists, err := pipedApi.FetchPlaylists(config.GetConfigurationServiceInstance().Configuration.Instance, pipedApi.GetToken())
+	pipedPlaylists, err := syncService.pipedClient.FetchPlaylists(ctx)
 	if err != nil {
 		return nil, err
 	}
+	var pipedPlaylistsById = make(map[string]pipedPlaylistDto.PlaylistDto)
 	for _, pipedPlaylist := range *pipedPlaylists {
-		if strings.HasPrefix(pipedPlaylist.Name, prefix) {
-			pipedPlaylistsByName[pipedPlaylist.Name] = pipedPlaylist
+		pipedPlaylistsById[pipedPlaylist.Id] = pipedPlaylist
+	}
+
+	// the stored playlists, forgetting the ones deleted by the user
+	managedPlaylists, err := playlistRepository.GetAll()
+	if err != nil {
+		return nil, utils.WrapError("unable to read the playlists from database", err)
+	}
+	for _, managedPlaylist := range *managedPlaylists {
+		pipedPlaylist, present := pipedPlaylistsById[managedPlaylist.PlaylistId]
+		if !present {
+			if err := playlistRepository.Delete(managedPlaylist.Bucket); err != nil {
+				return nil, utils.WrapError(fmt.Sprintf("unable to forget the deleted playlist '%s'", managedPlaylist.Name), err)
+			}
+			continue
+		}
+		pipedPlaylistsByBucket[managedPlaylist.Bucket] = pipedPlaylist
+		delete(pipedPlaylistsById, managedPlaylist.PlaylistId)
+	}
+
+	// the playlists named by the former versions, the other playlists of the user being left alone even if they share
+	// the prefix
+	for _, pipedPlaylist := range *pipedPlaylists {
+		if _, present := pipedPlaylistsById[pipedPlaylist.Id]; !present {
+			continue
+		}
+		legacyBucket, found := bucket.FromLegacyName(prefix, pipedPlaylist.Name)
+		if !found {
+			continue
+		}
+		bucketId := legacyBucket.Id
+		if _, present := pipedPlaylistsByBucket[bucketId]; present {
+			continue
+		}
+		_, err = playlistRepository.Save(playlistDb.ManagedPlaylist{
+			Bucket:     bucketId,
+			PlaylistId: pipedPlaylist.Id,
+			Name:       pipedPlaylist.Name,
+		})
+		if err != nil {
+			return nil, utils.WrapError(fmt.Sprintf("unable to save the playlist in database '%s'", pipedPlaylist.Name), err)
 		}
+		pipedPlaylistsByBucket[bucketId] = pipedPlaylist
 	}
-	return &pipedPlaylistsByName, nil
+	return &pipedPlaylistsByBucket, nil
 }
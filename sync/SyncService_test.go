@@ -0,0 +1,690 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"github.com/frajibe/piped-playfeed/config"
+	"github.com/frajibe/piped-playfeed/config/model"
+	"github.com/frajibe/piped-playfeed/db"
+	pipedApi "github.com/frajibe/piped-playfeed/piped/api"
+	"github.com/frajibe/piped-playfeed/piped/pipedtest"
+	"github.com/frajibe/piped-playfeed/settings"
+	"github.com/frajibe/piped-playfeed/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testUsername = "user"
+const testPassword = "password"
+
+func date(value string) time.Time {
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed.Add(12 * time.Hour)
+}
+
+// newTestServer returns a fake instance with two channels, the user being subscribed to both of them.
+func newTestServer(t *testing.T) *pipedtest.Server {
+	server := pipedtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddUser(testUsername, testPassword)
+	server.AddChannel(pipedtest.Channel{
+		Id:   "channel-a",
+		Name: "Channel A",
+		Videos: []pipedtest.Video{
+			{Id: "a-old", Uploaded: date("2022-12-15"), Views: 10},
+			{Id: "a-jan", Uploaded: date("2023-01-10"), Views: 10},
+			{Id: "a-feb", Uploaded: date("2023-02-03"), Views: 10},
+		},
+	})
+	server.AddChannel(pipedtest.Channel{
+		Id:   "channel-b",
+		Name: "Channel B",
+		Videos: []pipedtest.Video{
+			{Id: "b-jan", Uploaded: date("2023-01-20"), Views: 10},
+			{Id: "b-feb", Uploaded: date("2023-02-25"), Views: 10, HideListingDate: true},
+		},
+	})
+	server.Subscribe(testUsername, "channel-a")
+	server.Subscribe(testUsername, "channel-b")
+	return server
+}
+
+// newTestService returns a synchronization service bound to the fake instance and to a temporary database.
+func newTestService(t *testing.T, server *pipedtest.Server) *SynchronizationService {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "piped-playfeed.db")
+	utils.GetLoggingService().InitializeLogger(filepath.Join(dir, "piped-playfeed-log.json"), true, false, func() {})
+	settings.GetSettingsService().SilentMode = true
+
+	confService := config.GetConfigurationServiceInstance()
+	confService.Configuration = model.Configuration{
+		Instance: server.URL,
+		Account:  model.Account{Username: testUsername, Password: testPassword},
+		Database: dbPath,
+		Synchronization: model.Synchronization{
+			Strategy: model.PlaylistMonthlyStrategy,
+			Type:     model.SyncDateType,
+			Date:     "2023-01-01",
+		},
+	}
+	confService.Configuration.SetDefaults()
+
+	dbService := db.GetDatabaseServiceInstance()
+	if err := dbService.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dbService.Close() })
+
+	pipedClient := pipedApi.NewClient(server.URL, pipedApi.ClientOptions{
+		RetryPolicy: pipedApi.RetryPolicy{
+			MaxAttempts:  4,
+			InitialDelay: 10 * time.Millisecond,
+			MaxDelay:     2 * time.Second,
+		},
+		CircuitBreakerPolicy: pipedApi.CircuitBreakerPolicy{
+			FailureThreshold: 100,
+			Pause:            10 * time.Millisecond,
+		},
+	})
+	pipedClient.SetCredentials(testUsername, testPassword)
+	if err := pipedClient.Login(context.Background(), testUsername, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	syncService := &SynchronizationService{}
+	syncService.Init(pipedClient)
+	return syncService
+}
+
+func synchronize(t *testing.T, syncService *SynchronizationService) {
+	if err := syncService.Synchronize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertPlaylists(t *testing.T, server *pipedtest.Server, expected map[string][]string) {
+	t.Helper()
+	actual := make(map[string][]string)
+	for _, playlist := range server.Playlists(testUsername) {
+		actual[playlist.Name] = append([]string{}, playlist.VideoIds...)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected playlists\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestSynchronizeCreatesPlaylists(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+	channel, err := db.GetDatabaseServiceInstance().ChannelRepository.GetById("channel-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.LastUploaded != date("2023-02-03").UnixMilli() {
+		t.Errorf("unexpected channel cursor %d", channel.LastUploaded)
+	}
+}
+
+func TestSynchronizeIsIncremental(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronize(t, syncService)
+
+	// the user watches a video, and a new one is published
+	february := server.PlaylistByName(testUsername, "PF - 2023 February")
+	server.RemoveFromPlaylist(february.Id, "a-feb")
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-feb-2", Uploaded: date("2023-02-27"), Views: 10})
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb-2"},
+	})
+	video, err := db.GetDatabaseServiceInstance().VideoRepository.GetById("a-feb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Removed != 1 {
+		t.Errorf("the video removed by the user is not marked as removed")
+	}
+}
+
+func TestSynchronizeSurvivesFaults(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	server.InjectFault(pipedtest.Fault{Path: "/subscriptions", Count: 1, Status: http.StatusTooManyRequests, RetryAfter: time.Second})
+	server.InjectFault(pipedtest.Fault{Path: "/channel/channel-a", Count: 2, Status: http.StatusBadGateway})
+	server.InjectFault(pipedtest.Fault{Path: "/streams/", Count: 1, Status: http.StatusServiceUnavailable})
+	server.InjectFault(pipedtest.Fault{Path: "/user/playlists", Count: 1, Latency: 50 * time.Millisecond})
+
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+	if count := server.RequestCount("/subscriptions"); count != 2 {
+		t.Errorf("the rate-limited request has been sent %d times", count)
+	}
+}
+
+func TestSynchronizeSkipsBrokenChannel(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	server.InjectFault(pipedtest.Fault{Path: "/channel/channel-b", BrokenJson: true})
+
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"a-jan"},
+		"PF - 2023 February": {"a-feb"},
+	})
+}
+
+func TestSynchronizeAuthenticatesAgain(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	server.RevokeTokens()
+
+	synchronize(t, syncService)
+
+	if len(server.Playlists(testUsername)) != 2 {
+		t.Errorf("the playlists have not been created once authenticated again")
+	}
+	if count := server.RequestCount("/login"); count != 2 {
+		t.Errorf("unexpected number of logins: %d", count)
+	}
+}
+
+func TestSynchronizeDryRun(t *testing.T) {
+	server := newTestServer(t)
+	settings.GetSettingsService().DryRun = true
+	defer func() { settings.GetSettingsService().DryRun = false }()
+	syncService := newTestService(t, server)
+
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{})
+	if len(syncService.plan.PlaylistsToCreate) != 2 || len(syncService.plan.ChannelCursorMoves) != 2 {
+		t.Errorf("unexpected plan: %+v", syncService.plan)
+	}
+	if count := server.RequestCount("/user/playlists/create") + server.RequestCount("/user/playlists/add"); count != 0 {
+		t.Errorf("%d write requests sent in dry-run mode", count)
+	}
+	if _, err := os.Stat(config.GetConfigurationServiceInstance().Configuration.Database); err == nil {
+		t.Errorf("the database has been written in dry-run mode")
+	}
+}
+
+func TestSynchronizeResumesInterruptedRun(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	server.InjectFault(pipedtest.Fault{Path: "/user/playlists/add", Count: 1, Status: http.StatusBadRequest})
+
+	if err := syncService.Synchronize(context.Background()); err == nil {
+		t.Fatal("the synchronization should have failed")
+	}
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+	if count := server.RequestCount("/channel/"); count != 2 {
+		t.Errorf("the channels indexed by the interrupted run have been fetched again: %d requests", count)
+	}
+}
+
+func TestSynchronizeRollsBackFailedChannel(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	database, err := sql.Open("sqlite3", config.GetConfigurationServiceInstance().Configuration.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	_, err = database.Exec("CREATE TRIGGER fail_insert BEFORE INSERT ON subscriptions_videos WHEN NEW.id = 'a-feb' " +
+		"BEGIN SELECT RAISE(ABORT, 'insert failed'); END")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+	if exist, err := db.GetDatabaseServiceInstance().VideoRepository.Exists("a-jan"); err != nil || exist {
+		t.Errorf("the videos of the failed channel have been kept")
+	}
+
+	if _, err = database.Exec("DROP TRIGGER fail_insert"); err != nil {
+		t.Fatal(err)
+	}
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+}
+
+func TestSynchronizeBrowsesOverlapWindow(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronize(t, syncService)
+	knownVideoRequests := server.RequestCount("/streams/a-feb")
+
+	// listed by the instance after the previous run, although uploaded before the newest video
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-late", Uploaded: date("2023-02-03").Add(-3 * time.Hour), Views: 10})
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb", "a-late"},
+	})
+	if count := server.RequestCount("/streams/a-feb"); count != knownVideoRequests {
+		t.Errorf("the details of a known video have been fetched again")
+	}
+}
+
+func TestSynchronizeRenamesPlaylists(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronize(t, syncService)
+	february := server.PlaylistByName(testUsername, "PF - 2023 February")
+
+	// the playlists are found from their bucket, whatever their current name
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.NameTemplate = "{{.Prefix}}{{.MonthName}} {{.Year}}"
+	synchronization.Locale = "fr"
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-feb-2", Uploaded: date("2023-02-27"), Views: 10})
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - janvier 2023": {"b-jan", "a-jan"},
+		"PF - février 2023": {"b-feb", "a-feb", "a-feb-2"},
+	})
+	if renamed := server.PlaylistByName(testUsername, "PF - février 2023"); renamed.Id != february.Id {
+		t.Errorf("the playlist has been created again instead of being renamed")
+	}
+}
+
+func TestSynchronizeLeavesUserPlaylistsAlone(t *testing.T) {
+	server := newTestServer(t)
+	server.AddPlaylist(testUsername, "PF - Favorites", "a-old")
+	syncService := newTestService(t, server)
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Favorites":     {"a-old"},
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+	managedPlaylists, err := db.GetDatabaseServiceInstance().PlaylistRepository.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, managedPlaylist := range *managedPlaylists {
+		if managedPlaylist.Name == "PF - Favorites" {
+			t.Fatalf("the playlist of the user is managed: %+v", managedPlaylist)
+		}
+	}
+}
+
+func TestRebucketMovesVideosToTheirWeek(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Strategy = model.PlaylistWeeklyStrategy
+	synchronization.Timezone = "UTC"
+	synchronize(t, syncService)
+
+	// the Saturday 2023-02-25 starts the 9th week once the weeks start on Saturday
+	synchronization.WeekStart = "saturday"
+	if err := syncService.Rebucket(); err != nil {
+		t.Fatal(err)
+	}
+	synchronize(t, syncService)
+
+	// the week left empty is deleted
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 Week 2": {"a-jan"},
+		"PF - 2023 Week 3": {"b-jan"},
+		"PF - 2023 Week 5": {"a-feb"},
+		"PF - 2023 Week 9": {"b-feb"},
+	})
+	managedPlaylists, err := db.GetDatabaseServiceInstance().PlaylistRepository.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, managedPlaylist := range *managedPlaylists {
+		if managedPlaylist.Name == "PF - 2023 Week 8" {
+			t.Errorf("the deleted playlist is still managed: %+v", managedPlaylist)
+		}
+	}
+}
+
+func TestSynchronizeRollingWindow(t *testing.T) {
+	server := newTestServer(t)
+	now := time.Now().UTC()
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-recent", Uploaded: now.AddDate(0, 0, -2), Views: 10})
+	server.AddVideo("channel-b", pipedtest.Video{Id: "b-recent", Uploaded: now.Add(-time.Minute), Views: 10})
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Strategy = model.PlaylistRollingStrategy
+	synchronization.Timezone = "UTC"
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Last 7 days": {"b-recent", "a-recent"},
+	})
+
+	// the videos leaving the window are dropped, even without new videos
+	synchronization.RollingDays = 1
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Last 1 days": {"b-recent"},
+	})
+}
+
+func TestSynchronizeChannelPlaylists(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.ChannelPlaylists = []string{"channel-a"}
+	synchronization.ChannelOrder = model.ChannelOrderOldest
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Channel A":     {"a-jan", "a-feb"},
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+
+	// the playlist follows the channel name, and the newest videos stay first once the order is reversed
+	server.RenameChannel("channel-a", "Channel A2")
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-feb-2", Uploaded: date("2023-02-27"), Views: 10})
+	synchronization.ChannelOrder = model.ChannelOrderNewest
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Channel A2":    {"a-feb-2", "a-feb", "a-jan"},
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+}
+
+func TestSynchronizeChannelPlaylistsKeepsVideosWhenRebuildFails(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.ChannelPlaylists = []string{"channel-a"}
+	synchronization.ChannelOrder = model.ChannelOrderOldest
+	synchronize(t, syncService)
+
+	// reversing the order rebuilds the playlist, whose videos are kept when the additions fail
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-feb-2", Uploaded: date("2023-02-27"), Views: 10})
+	synchronization.ChannelOrder = model.ChannelOrderNewest
+	server.InjectFault(pipedtest.Fault{Path: "/user/playlists/add", Count: 1, Status: http.StatusBadRequest})
+	if err := syncService.Synchronize(context.Background()); err == nil {
+		t.Fatal("the synchronization should have failed")
+	}
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Channel A":     {"a-jan", "a-feb"},
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+
+	synchronize(t, syncService)
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Channel A":     {"a-feb-2", "a-feb", "a-jan"},
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+}
+
+func TestSynchronizeChannelGroups(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.ChannelGroups = []model.ChannelGroup{{
+		Name:     "Tech",
+		Channels: []string{"https://www.youtube.com/channel/channel-a"},
+		Strategy: model.PlaylistWeeklyStrategy,
+	}}
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"Tech - 2023 Week 2": {"a-jan"},
+		"Tech - 2023 Week 5": {"a-feb"},
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb"},
+	})
+}
+
+func TestSynchronizeRules(t *testing.T) {
+	server := newTestServer(t)
+	server.UpdateVideo("a-jan", func(video *pipedtest.Video) { video.Category = "Music" })
+	server.UpdateVideo("b-jan", func(video *pipedtest.Video) { video.Title = "Trailer: coming soon" })
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Rules = []model.Rule{
+		{Name: "music", Categories: []string{"music"}, Playlist: "{{.Prefix}}Music {{.Year}}", Strategy: model.PlaylistYearlyStrategy},
+		{Name: "trailers", Title: "^Trailer", Action: model.RuleActionIgnore},
+	}
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - Music 2023":    {"a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+
+	explanation, err := syncService.ExplainRules(context.Background(), "b-jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !explanation.Ignored || len(explanation.Evaluations) != 2 || explanation.Evaluations[0].Matched || !explanation.Evaluations[1].Matched {
+		t.Fatalf("unexpected explanation: %+v", explanation)
+	}
+}
+
+func TestExplainRulesOfShorts(t *testing.T) {
+	server := newTestServer(t)
+	server.UpdateVideo("a-feb", func(video *pipedtest.Video) {
+		video.IsShort = true
+		video.Duration = 45
+	})
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Shorts = model.ShortsSeparate
+	synchronization.Rules = []model.Rule{{Name: "all", Playlist: "{{.Prefix}}All {{.Year}}", Strategy: model.PlaylistYearlyStrategy}}
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	// the short is known from its details only, and routed like by the synchronization
+	assertPlaylists(t, server, map[string][]string{
+		"PF - All 2023":               {"b-feb", "b-jan", "a-jan"},
+		"PF - Shorts - 2023 February": {"a-feb"},
+	})
+	explanation, err := syncService.ExplainRules(context.Background(), "a-feb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Ignored || !reflect.DeepEqual(explanation.Playlists, []string{"PF - Shorts - 2023 February"}) {
+		t.Fatalf("unexpected explanation: %+v", explanation)
+	}
+}
+
+func TestSynchronizeStoresMetadata(t *testing.T) {
+	server := newTestServer(t)
+	server.UpdateVideo("a-jan", func(video *pipedtest.Video) {
+		video.Title = "January"
+		video.Duration = 600
+		video.Category = "Education"
+		video.Description = "<p>Hello &amp; <b>welcome</b></p>"
+	})
+	syncService := newTestService(t, server)
+	synchronize(t, syncService)
+
+	metadataRepository := db.GetDatabaseServiceInstance().MetadataRepository
+	videoMetadata, err := metadataRepository.GetById("a-jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if videoMetadata.Title != "January" || videoMetadata.Duration != 600 || videoMetadata.Uploader != "Channel A" ||
+		videoMetadata.UploaderId != "channel-a" || videoMetadata.Views != 10 {
+		t.Fatalf("unexpected metadata: %+v", videoMetadata)
+	}
+	// the videos indexed from the listings are completed from their details by the backfill
+	if !videoMetadata.Detailed || videoMetadata.Category != "Education" || videoMetadata.Description != "Hello & welcome" {
+		t.Fatalf("unexpected backfilled metadata: %+v", videoMetadata)
+	}
+	videoIds, err := metadataRepository.GetIdsToBackfill(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*videoIds) != 0 {
+		t.Fatalf("unexpected videos to backfill: %v", *videoIds)
+	}
+}
+
+func TestSynchronizeShorts(t *testing.T) {
+	server := newTestServer(t)
+	server.UpdateVideo("a-feb", func(video *pipedtest.Video) { video.IsShort = true })
+	server.UpdateVideo("b-jan", func(video *pipedtest.Video) { video.IsShort = true })
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Shorts = model.ShortsSeparate
+	synchronization.ChannelShorts = map[string]string{"channel-b": model.ShortsExclude}
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":           {"a-jan"},
+		"PF - 2023 February":          {"b-feb"},
+		"PF - Shorts - 2023 February": {"a-feb"},
+	})
+	// the excluded shorts are recorded, so that they are not evaluated again
+	exist, err := db.GetDatabaseServiceInstance().VideoRepository.Exists("b-jan")
+	if err != nil || !exist {
+		t.Fatalf("the excluded short is not recorded: %v", err)
+	}
+}
+
+func TestSynchronizeUpcomingVideos(t *testing.T) {
+	server := newTestServer(t)
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-premiere", Uploaded: date("2023-01-15"), Views: 10, Upcoming: true})
+	server.AddVideo("channel-b", pipedtest.Video{Id: "b-live", Uploaded: date("2023-01-25"), Views: 10, Upcoming: true})
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Livestreams = model.LivestreamsExclude
+	synchronize(t, syncService)
+
+	// the premiere goes live once the channel cursor has moved past it
+	server.UpdateVideo("a-premiere", func(video *pipedtest.Video) { video.Upcoming = false })
+	server.UpdateVideo("b-live", func(video *pipedtest.Video) {
+		video.Upcoming = false
+		video.Livestream = true
+	})
+	synchronize(t, syncService)
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan", "a-premiere"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+
+	// the VOD of the livestream is left out
+	server.UpdateVideo("b-live", func(video *pipedtest.Video) { video.Livestream = false })
+	synchronize(t, syncService)
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan", "a-premiere"},
+		"PF - 2023 February": {"b-feb", "a-feb"},
+	})
+	upcomingVideos, err := db.GetDatabaseServiceInstance().UpcomingRepository.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*upcomingVideos) != 0 {
+		t.Fatalf("unexpected upcoming videos: %+v", *upcomingVideos)
+	}
+}
+
+func TestSynchronizeFilesUnseenLivestreams(t *testing.T) {
+	server := newTestServer(t)
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Livestreams = model.LivestreamsExclude
+	synchronize(t, syncService)
+
+	// the livestream started and ended between the two synchronizations: nothing tells its VOD from a video
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-stream", Uploaded: date("2023-02-10"), Views: 10, Duration: 3600})
+	synchronize(t, syncService)
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan", "a-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb", "a-stream"},
+	})
+}
+
+func TestSynchronizePremieredShorts(t *testing.T) {
+	server := newTestServer(t)
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-premiere", Uploaded: date("2023-01-15"), Views: 10, Duration: 50, IsShort: true, Upcoming: true})
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.Shorts = model.ShortsSeparate
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	// the premiere is only known from its details once published
+	server.UpdateVideo("a-premiere", func(video *pipedtest.Video) { video.Upcoming = false })
+	synchronize(t, syncService)
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":          {"b-jan", "a-jan"},
+		"PF - 2023 February":         {"b-feb", "a-feb"},
+		"PF - Shorts - 2023 January": {"a-premiere"},
+	})
+	videoMetadata, err := db.GetDatabaseServiceInstance().MetadataRepository.GetById("a-premiere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !videoMetadata.Short {
+		t.Fatalf("unexpected metadata: %+v", videoMetadata)
+	}
+}
+
+func TestSynchronizeBudget(t *testing.T) {
+	server := newTestServer(t)
+	server.AddVideo("channel-a", pipedtest.Video{Id: "a-long", Uploaded: date("2023-01-12"), Views: 10, Duration: 10000})
+	for videoId, duration := range map[string]int64{"a-jan": 2400, "a-feb": 600, "b-jan": 1800, "b-feb": 600} {
+		duration := duration
+		server.UpdateVideo(videoId, func(video *pipedtest.Video) { video.Duration = duration })
+	}
+	syncService := newTestService(t, server)
+	synchronization := &config.GetConfigurationServiceInstance().Configuration.Synchronization
+	synchronization.VideoDuration = model.DurationFilter{MaxDuration: 7200}
+	synchronization.Budget = model.Budget{Hours: 1, ChannelPriorities: []string{"channel-b"}}
+	synchronization.SetDefaults()
+	synchronize(t, syncService)
+
+	// the video of the channel with the lowest priority overflows into the next month
+	assertPlaylists(t, server, map[string][]string{
+		"PF - 2023 January":  {"b-jan"},
+		"PF - 2023 February": {"b-feb", "a-feb", "a-jan"},
+	})
+}
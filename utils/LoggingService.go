@@ -29,7 +29,11 @@ func GetLoggingService() *LoggingService {
 	return instance
 }
 
-func (loggingService *LoggingService) InitializeLogger(logFilePath string, debug bool, properlyTerminateApp func()) {
+// InitializeLogger creates the log file if needed.
+//
+// Only the warnings and the errors are written into the log file, unless verbose (information messages are written
+// too) or debug (all the messages are written).
+func (loggingService *LoggingService) InitializeLogger(logFilePath string, debug bool, verbose bool, properlyTerminateApp func()) {
 	// remove date time from the builtin logger which is used in addition to Zap
 	log.SetFlags(0)
 
@@ -45,6 +49,8 @@ func (loggingService *LoggingService) InitializeLogger(logFilePath string, debug
 	var defaultLogFileLevel zapcore.Level
 	if debug {
 		defaultLogFileLevel = zapcore.DebugLevel
+	} else if verbose {
+		defaultLogFileLevel = zapcore.InfoLevel
 	} else {
 		defaultLogFileLevel = zapcore.WarnLevel
 	}